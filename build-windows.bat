@@ -2,7 +2,7 @@
 echo Building 64-bit Windows executable...
 set GOOS=windows
 set GOARCH=amd64
-go build -ldflags "-s -w" -o media-server-windows-amd64.exe
+go build -tags sqlite_fts5 -ldflags "-s -w" -o media-server-windows-amd64.exe
 if errorlevel 1 (
     echo Failed to build 64-bit executable
     exit /b 1
@@ -11,7 +11,7 @@ if errorlevel 1 (
 echo Building 32-bit Windows executable...
 set GOOS=windows
 set GOARCH=386
-go build -ldflags "-s -w" -o media-server-windows-386.exe
+go build -tags sqlite_fts5 -ldflags "-s -w" -o media-server-windows-386.exe
 if errorlevel 1 (
     echo Failed to build 32-bit executable
     exit /b 1
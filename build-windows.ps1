@@ -3,7 +3,7 @@
 Write-Host "Building 64-bit Windows executable..."
 $env:GOOS = "windows"
 $env:GOARCH = "amd64"
-go build -ldflags "-s -w" -o "media-server-windows-amd64.exe"
+go build -tags sqlite_fts5 -ldflags "-s -w" -o "media-server-windows-amd64.exe"
 if ($LASTEXITCODE -ne 0) {
     Write-Error "Failed to build 64-bit executable"
     exit $LASTEXITCODE
@@ -12,7 +12,7 @@ if ($LASTEXITCODE -ne 0) {
 Write-Host "Building 32-bit Windows executable..."
 $env:GOOS = "windows"
 $env:GOARCH = "386"
-go build -ldflags "-s -w" -o "media-server-windows-386.exe"
+go build -tags sqlite_fts5 -ldflags "-s -w" -o "media-server-windows-386.exe"
 if ($LASTEXITCODE -ne 0) {
     Write-Error "Failed to build 32-bit executable"
     exit $LASTEXITCODE
@@ -0,0 +1,73 @@
+package database
+
+import (
+	"media_server/internal/media"
+	"path/filepath"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// RoleAdmin may see every library and manage users and the config.
+	RoleAdmin = "admin"
+	// RoleUser may browse and stream its libraries and keeps its own watch
+	// progress.
+	RoleUser = "user"
+	// RoleGuest is a read-only RoleUser, meant for shared accounts.
+	RoleGuest = "guest"
+)
+
+// ValidRole reports whether role is one of the known roles.
+func ValidRole(role string) bool {
+	return role == RoleAdmin || role == RoleUser || role == RoleGuest
+}
+
+// Access limits queries to the media libraries (configured media
+// directories) a user may see. The zero value allows nothing.
+type Access struct {
+	All   bool
+	Roots []string
+}
+
+// FullAccess allows every library.
+var FullAccess = Access{All: true}
+
+// Allows reports whether media stored under root may be seen. Libraries
+// nested in an allowed one are allowed too.
+func (a Access) Allows(root string) bool {
+	if a.All {
+		return true
+	}
+	if root == "" {
+		return false
+	}
+	for _, allowed := range a.Roots {
+		if media.IsWithin(root, allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// scope restricts tx, a query on media_items, to the allowed libraries.
+func (a Access) scope(tx *gorm.DB) *gorm.DB {
+	if a.All {
+		return tx
+	}
+	if len(a.Roots) == 0 {
+		return tx.Where("1 = 0")
+	}
+
+	conditions := make([]string, 0, len(a.Roots))
+	args := make([]interface{}, 0, 2*len(a.Roots))
+	for _, root := range a.Roots {
+		dir := root
+		if !strings.HasSuffix(dir, string(filepath.Separator)) {
+			dir += string(filepath.Separator)
+		}
+		conditions = append(conditions, "media_items.root = ? OR media_items.root LIKE ? ESCAPE '\\'")
+		args = append(args, root, escapeLike(dir)+"%")
+	}
+	return tx.Where("("+strings.Join(conditions, " OR ")+")", args...)
+}
@@ -0,0 +1,68 @@
+package database
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+)
+
+func TestAccessAllows(t *testing.T) {
+	tests := []struct {
+		name   string
+		access Access
+		root   string
+		want   bool
+	}{
+		{"nothing allowed", Access{}, "/films", false},
+		{"full access", FullAccess, "/films", true},
+		{"full access, no root", FullAccess, "", true},
+		{"allowed library", Access{Roots: []string{"/films"}}, "/films", true},
+		{"nested library", Access{Roots: []string{"/films"}}, "/films/classics", true},
+		{"sibling with a common prefix", Access{Roots: []string{"/films"}}, "/films-old", false},
+		{"other library", Access{Roots: []string{"/films"}}, "/music", false},
+		{"no root", Access{Roots: []string{"/films"}}, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.access.Allows(tt.root); got != tt.want {
+				t.Errorf("Allows(%q) = %v, want %v", tt.root, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetByCursorAccess(t *testing.T) {
+	db := newTestDB(t)
+	for i, root := range []string{"/films", "/music", "/films"} {
+		item := MediaItem{ID: fmt.Sprintf("id%d", i), Name: fmt.Sprintf("item %d", i), Root: root}
+		if err := db.DB.Create(&item).Error; err != nil {
+			t.Fatalf("create: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		access Access
+		want   []string
+	}{
+		{"none", Access{}, nil},
+		{"one library", Access{Roots: []string{"/films"}}, []string{"id0", "id2"}},
+		{"all", FullAccess, []string{"id0", "id1", "id2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := ListOptions{Sort: SortName, Order: OrderAsc, Access: tt.access}
+			items, _, _, err := db.GetByCursor("", 10, opts)
+			if err != nil {
+				t.Fatalf("GetByCursor: %v", err)
+			}
+			var got []string
+			for _, item := range items {
+				got = append(got, item.ID)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("items = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
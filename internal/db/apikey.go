@@ -0,0 +1,128 @@
+package database
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// ScopeRead allows browsing, searching and reading metadata.
+	ScopeRead = "read"
+	// ScopeStream allows streaming and recording watch progress.
+	ScopeStream = "stream"
+	// ScopeAdmin allows administration and implies the other scopes.
+	ScopeAdmin = "admin"
+
+	// APIKeyPrefix starts every API key, telling them apart from session
+	// tokens.
+	APIKeyPrefix = "msk_"
+
+	// lastUsedResolution is how stale the recorded last use of a key may get
+	// before it's written again, to avoid a write on every request.
+	lastUsedResolution = time.Minute
+)
+
+var ErrInvalidAPIKey = errors.New("invalid API key")
+
+// ValidScope reports whether scope is one of the known scopes.
+func ValidScope(scope string) bool {
+	return scope == ScopeRead || scope == ScopeStream || scope == ScopeAdmin
+}
+
+// APIKey is a long-lived credential for scripts and integrations. It acts
+// for the user that created it, limited to its scopes. Only a hash of the
+// key is stored.
+type APIKey struct {
+	ID     uint   `gorm:"primaryKey" json:"id"`
+	Name   string `gorm:"not null" json:"name" example:"backup script"`
+	UserID uint   `gorm:"index;not null" json:"user_id"`
+	User   User   `gorm:"constraint:OnDelete:CASCADE" json:"-"`
+	// Prefix is the start of the key, to recognise it in listings.
+	Prefix     string     `gorm:"not null" json:"prefix" example:"msk_1a2b3c4d"`
+	KeyHash    string     `gorm:"uniqueIndex;not null" json:"-"`
+	Scopes     []string   `gorm:"type:text;serializer:json" json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+}
+
+// CreateAPIKey stores a new key for userID and returns it together with the
+// key itself, which can't be recovered later.
+func (object DBObject) CreateAPIKey(userID uint, name string, scopes []string) (APIKey, string, error) {
+	token, err := RandomToken()
+	if err != nil {
+		return APIKey{}, "", err
+	}
+	token = APIKeyPrefix + token
+
+	key := APIKey{
+		Name:    strings.TrimSpace(name),
+		UserID:  userID,
+		Prefix:  token[:len(APIKeyPrefix)+8],
+		KeyHash: hashToken(token),
+		Scopes:  scopes,
+	}
+	if err := object.DB.Create(&key).Error; err != nil {
+		return APIKey{}, "", err
+	}
+	return key, token, nil
+}
+
+// GetAPIKeys returns the keys of userID, newest first.
+func (object DBObject) GetAPIKeys(userID uint) ([]APIKey, error) {
+	var keys []APIKey
+	err := object.DB.Where("user_id = ?", userID).Order("created_at DESC").Find(&keys).Error
+	return keys, err
+}
+
+// DeleteAPIKey revokes a key of userID.
+func (object DBObject) DeleteAPIKey(userID uint, id uint) error {
+	res := object.DB.Where("id = ? AND user_id = ?", id, userID).Delete(&APIKey{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// APIKeyUser returns the user an API key acts for, with Scopes set to the
+// key's scopes, and records the use.
+func (object DBObject) APIKeyUser(token string) (User, error) {
+	var key APIKey
+	err := object.DB.Preload("User").Where("key_hash = ?", hashToken(token)).First(&key).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return User{}, ErrInvalidAPIKey
+	}
+	if err != nil {
+		return User{}, err
+	}
+
+	now := time.Now()
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) > lastUsedResolution {
+		if err := object.DB.Model(&key).Update("last_used_at", now).Error; err != nil {
+			return User{}, err
+		}
+	}
+
+	user := key.User
+	user.Scopes = key.Scopes
+	if user.Scopes == nil {
+		user.Scopes = []string{}
+	}
+	return user, nil
+}
+
+// HasScope reports whether the user's credentials grant scope. Sessions grant
+// every scope; API keys only those they were created with, where admin
+// implies the others.
+func (u User) HasScope(scope string) bool {
+	if u.Scopes == nil {
+		return true
+	}
+	return slices.Contains(u.Scopes, scope) || slices.Contains(u.Scopes, ScopeAdmin)
+}
@@ -4,26 +4,93 @@ import (
 	"fmt"
 	"media_server/internal/logger"
 	"media_server/internal/media"
+	"net/url"
+	"path/filepath"
+	"strings"
 	"sync"
+	"time"
 
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type MediaItem struct {
-	ID   string `gorm:"primaryKey" json:"id"`
-	Name string `json:"name"`
-	Path string `json:"path"`
-	Ext  string `gorm:"default:''" json:"ext"`
+	ID        string         `gorm:"primaryKey" json:"id"`
+	Name      string         `json:"name"`
+	Path      string         `json:"path"`
+	Ext       string         `gorm:"default:''" json:"ext"`
+	Root      string         `gorm:"index;default:''" json:"root"`
+	Type      string         `gorm:"index;default:''" json:"type" example:"video"` // video, audio, image or subtitle
+	CreatedAt time.Time      `json:"created_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-" swaggerignore:"true"`
+
+	// Technical metadata, filled in by ffprobe during scanning.
+	Duration   float64    `json:"duration"`
+	Container  string     `json:"container"`
+	VideoCodec string     `json:"video_codec"`
+	AudioCodec string     `json:"audio_codec"`
+	Width      int        `json:"width"`
+	Height     int        `json:"height"`
+	FrameRate  float64    `json:"frame_rate"`
+	Bitrate    int64      `json:"bitrate"`
+	Size       int64      `json:"size"`
+	DirectPlay bool       `json:"direct_play"`
+	ProbedAt   *time.Time `json:"probed_at,omitempty"`
+
+	// Pre-transcoded rendition, produced in the background when on-demand
+	// streaming is disabled.
+	RenditionStatus string `gorm:"default:''" json:"rendition_status,omitempty"`
+	RenditionPath   string `gorm:"default:''" json:"-"`
+	ThumbnailStatus string `gorm:"default:''" json:"thumbnail_status,omitempty"`
+	ThumbnailError  string `gorm:"default:''" json:"thumbnail_error,omitempty"`
+
+	// StreamMode tells clients how /media/{id}/stream will serve the item.
+	StreamMode string `gorm:"-" json:"stream_mode,omitempty"`
+
+	Tracks   []MediaTrack   `gorm:"foreignKey:MediaID;constraint:OnDelete:CASCADE" json:"tracks,omitempty"`
+	Chapters []MediaChapter `gorm:"foreignKey:MediaID;constraint:OnDelete:CASCADE" json:"chapters,omitempty"`
+}
+
+// SyncReport summarises a reconciliation pass between a scan and the media
+// table.
+type SyncReport struct {
+	Added     int `json:"added"`
+	Removed   int `json:"removed"`
+	Unchanged int `json:"unchanged"`
 }
 
 type DBObject struct {
 	DB  *gorm.DB
 	Err error
+	// FullTextSearch is set when the SQLite build supports FTS5.
+	FullTextSearch bool
+	// Listener, if set, is told about media being added and removed.
+	Listener Listener
+}
+
+// sqliteDSN adds a busy timeout and immediate transactions to dbPath, so that
+// every pooled connection waits for concurrent writers (scan and thumbnail
+// workers, watcher, API requests) instead of failing with "database is
+// locked". Options already present in dbPath take precedence.
+func sqliteDSN(dbPath string) string {
+	path, rawQuery, _ := strings.Cut(dbPath, "?")
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		logger.Log().Sugar().Warnf("Failed to parse database options %q: %v\n", rawQuery, err)
+		return dbPath
+	}
+	if !query.Has("_busy_timeout") && !query.Has("_timeout") {
+		query.Set("_busy_timeout", "5000")
+	}
+	if !query.Has("_txlock") {
+		query.Set("_txlock", "immediate")
+	}
+	return path + "?" + query.Encode()
 }
 
 func InitDataBase(dbPath string) DBObject {
-	db, err := gorm.Open(sqlite.Open(dbPath), &gorm.Config{})
+	db, err := gorm.Open(sqlite.Open(sqliteDSN(dbPath)), &gorm.Config{})
 	if err != nil {
 		logger.Log().Sugar().Errorf("Failed to init db: %v \n", err)
 		return DBObject{DB: nil, Err: err}
@@ -45,28 +112,228 @@ func InitDataBase(dbPath string) DBObject {
 
 	logger.Log().Info("Database connection launched")
 
-	err = db.AutoMigrate(&MediaItem{})
+	err = db.AutoMigrate(&MediaItem{}, &MediaTrack{}, &MediaChapter{}, &PlaybackState{}, &User{}, &Session{}, &ShareLink{}, &Setting{}, &APIKey{})
 	if err != nil {
 		logger.Log().Sugar().Errorf("Failed to auto-migrate MediaItem: %v \n", err)
 		return DBObject{DB: nil, Err: err}
 	}
-	return DBObject{DB: db, Err: nil}
+	// Rows stored before these columns existed hold NULLs, which would break
+	// sorting and keyset pagination on them.
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&MediaItem{}).Unscoped().Where("created_at IS NULL").Update("created_at", time.Now()).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&MediaItem{}).Unscoped().Where("size IS NULL").Update("size", 0).Error; err != nil {
+			return err
+		}
+		return tx.Model(&MediaItem{}).Unscoped().Where("duration IS NULL").Update("duration", 0).Error
+	})
+	if err != nil {
+		logger.Log().Sugar().Errorf("Failed to backfill media columns: %v \n", err)
+		return DBObject{DB: nil, Err: err}
+	}
+	if err := backfillTypes(db); err != nil {
+		logger.Log().Sugar().Errorf("Failed to backfill media types: %v \n", err)
+		return DBObject{DB: nil, Err: err}
+	}
+
+	return DBObject{DB: db, Err: nil, FullTextSearch: initSearch(db)}
 }
 
+// backfillTypes sets the type of rows stored before the column existed from
+// their extension, using the built-in registry. The next scan corrects the
+// ones the config classifies differently.
+func backfillTypes(db *gorm.DB) error {
+	var exts []string
+	if err := db.Model(&MediaItem{}).Unscoped().Where("type = ''").Distinct().Pluck("ext", &exts).Error; err != nil {
+		return err
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, ext := range exts {
+			kind := media.KindOfExt(ext)
+			if kind == "" {
+				continue
+			}
+			if err := tx.Model(&MediaItem{}).Unscoped().Where("type = '' AND ext = ?", ext).Update("type", kind).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// AddMediaItem inserts the item if it isn't stored yet, reviving it if it was
+// previously tombstoned.
 func (object DBObject) AddMediaItem(item *MediaItem) error {
-	result := object.DB.FirstOrCreate(item, MediaItem{ID: item.ID})
+	var existing MediaItem
+	result := object.DB.Unscoped().Where("id = ?", item.ID).Limit(1).Find(&existing)
 	if result.Error != nil {
 		return result.Error
 	}
-	if result.RowsAffected == 0 {
-		logger.Log().Sugar().Infof("Media %s already exists", item.ID)
-	} else {
+
+	switch {
+	case result.RowsAffected == 0:
+		if err := object.DB.Create(item).Error; err != nil {
+			return err
+		}
 		logger.Log().Sugar().Infof("Media %s added to DB", item.ID)
+		object.mediaAdded(*item)
+	case existing.DeletedAt.Valid:
+		// The file may be back under another media directory, or be of
+		// another kind under the current config.
+		err := object.DB.Unscoped().Model(&existing).Updates(map[string]interface{}{
+			"deleted_at": nil,
+			"name":       item.Name,
+			"path":       item.Path,
+			"ext":        item.Ext,
+			"root":       item.Root,
+			"type":       item.Type,
+		}).Error
+		if err != nil {
+			return err
+		}
+		logger.Log().Sugar().Infof("Media %s restored", item.ID)
+		existing.DeletedAt = gorm.DeletedAt{}
+		existing.Name, existing.Path, existing.Ext = item.Name, item.Path, item.Ext
+		existing.Root, existing.Type = item.Root, item.Type
+		object.mediaAdded(existing)
+	default:
+		logger.Log().Sugar().Infof("Media %s already exists", item.ID)
+	}
+	return nil
+}
+
+// UpsertMediaItem inserts the item or, if it already exists (even as a
+// tombstone), overwrites the stored row with the new values.
+func (object DBObject) UpsertMediaItem(item *MediaItem) error {
+	var live int64
+	if err := object.DB.Model(&MediaItem{}).Where("id = ?", item.ID).Count(&live).Error; err != nil {
+		return err
+	}
+
+	err := object.DB.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "id"}},
+		// A changed file invalidates any rendition or thumbnail outcome
+		// recorded for the old one.
+		DoUpdates: clause.AssignmentColumns([]string{
+			"name", "path", "ext", "root", "type", "deleted_at",
+			"rendition_status", "rendition_path",
+			"thumbnail_status", "thumbnail_error",
+		}),
+	}).Create(item).Error
+	if err != nil {
+		return err
+	}
+	logger.Log().Sugar().Infof("Media %s upserted", item.ID)
+	if live == 0 {
+		object.mediaAdded(*item)
 	}
 	return nil
 }
 
-func (object DBObject) GetPaginated(page int, count int) (itemList []MediaItem, numberOfElements int, pages int, err error) {
+// setColumn sets column to value for the given items.
+func (object DBObject) setColumn(ids []string, column string, value string) error {
+	const batchSize = 500
+	for start := 0; start < len(ids); start += batchSize {
+		end := min(start+batchSize, len(ids))
+		err := object.DB.Model(&MediaItem{}).Where("id IN ?", ids[start:end]).Update(column, value).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SoftDeleteMediaItems tombstones the given items and returns how many rows
+// were affected.
+func (object DBObject) SoftDeleteMediaItems(ids []string) (int64, error) {
+	const batchSize = 500
+	var removed int64
+	for start := 0; start < len(ids); start += batchSize {
+		end := min(start+batchSize, len(ids))
+		items, err := object.tombstone("id IN ?", ids[start:end])
+		if err != nil {
+			return removed, err
+		}
+		removed += int64(len(items))
+	}
+	return removed, nil
+}
+
+// DeleteMediaUnder tombstones every media item stored at or below dir and
+// returns how many rows were removed.
+func (object DBObject) DeleteMediaUnder(dir string) (int64, error) {
+	dir = filepath.Clean(dir)
+	items, err := object.tombstone(pathUnder, dir, likePrefix(dir))
+	return int64(len(items)), err
+}
+
+// DeleteMediaInRoot tombstones the media indexed under the media directory
+// root, e.g. after it was removed from the config, and reports it to the
+// listener as a finished sync of root.
+func (object DBObject) DeleteMediaInRoot(root string) (int64, error) {
+	root = filepath.Clean(root)
+	items, err := object.tombstone("root = ?", root)
+	if err != nil {
+		return 0, err
+	}
+	object.syncProgress(SyncProgress{Dir: root, Removed: len(items)})
+	return int64(len(items)), nil
+}
+
+// pathUnder matches the items at or below a directory, given the directory
+// and its likePrefix.
+const pathUnder = "path = ? OR path LIKE ? ESCAPE '\\'"
+
+// likePrefix returns the LIKE pattern matching everything below dir.
+func likePrefix(dir string) string {
+	return escapeLike(dir+string(filepath.Separator)) + "%"
+}
+
+// tombstone soft-deletes the live items matching the condition and tells the
+// listener which ones they were.
+func (object DBObject) tombstone(query string, args ...interface{}) ([]MediaItem, error) {
+	var items []MediaItem
+	err := object.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Select("id", "name", "path", "root").Where(query, args...).Find(&items).Error; err != nil {
+			return err
+		}
+		if len(items) == 0 {
+			return nil
+		}
+		ids := make([]string, len(items))
+		for i, item := range items {
+			ids[i] = item.ID
+		}
+		return tx.Where("id IN ?", ids).Delete(&MediaItem{}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	object.mediaRemoved(items)
+	return items, nil
+}
+
+func escapeLike(value string) string {
+	replacer := strings.NewReplacer("\\", "\\\\", "%", "\\%", "_", "\\_")
+	return replacer.Replace(value)
+}
+
+// MediaItemFromFile converts a scanned media file into its database row.
+func MediaItemFromFile(file media.MediaFile) MediaItem {
+	return MediaItem{
+		ID:   file.ID,
+		Name: file.Name,
+		Path: file.Path,
+		Ext:  file.Ext,
+		Root: file.Root,
+		Type: file.Type,
+	}
+}
+
+// GetPaginated returns one page of media items sorted and filtered as
+// described by opts, which must have been normalized.
+func (object DBObject) GetPaginated(page int, count int, opts ListOptions) (itemList []MediaItem, numberOfElements int, pages int, err error) {
 	offset := (page - 1) * count
 	var total_number_of_rows int64
 	var items []MediaItem
@@ -78,20 +345,21 @@ func (object DBObject) GetPaginated(page int, count int) (itemList []MediaItem,
 		return nil, 0, 0, fmt.Errorf("count number can't be less than one\n")
 	}
 
-	if err := object.DB.Model(&MediaItem{}).Count(&total_number_of_rows).Error; err != nil {
+	if err := opts.filter(object.DB.Model(&MediaItem{})).Count(&total_number_of_rows).Error; err != nil {
 		return nil, 0, 0, err
 	}
 	page_no := (total_number_of_rows + int64(count) - 1) / int64(count)
 
-	if err := object.DB.Limit(count).Offset(offset).Find(&items).Error; err != nil {
+	if err := opts.filter(object.DB).Order(opts.orderBy()).Limit(count).Offset(offset).Find(&items).Error; err != nil {
 		return nil, 0, 0, err
 	}
 	return items, len(items), int(page_no), nil
 }
 
-func (object DBObject) GetAll() ([]MediaItem, error) {
+// GetAll returns every media item in the libraries allowed by access.
+func (object DBObject) GetAll(access Access) ([]MediaItem, error) {
 	var items []MediaItem
-	err := object.DB.Find(&items).Error
+	err := access.scope(object.DB).Find(&items).Error
 	if err != nil {
 		return nil, err
 	}
@@ -101,7 +369,12 @@ func (object DBObject) GetAll() ([]MediaItem, error) {
 func (object DBObject) GetByID(id string) (MediaItem, error) {
 	var item MediaItem
 
-	if err := object.DB.Where("id = ?", id).First(&item).Error; err != nil {
+	err := object.DB.Preload("Tracks", func(db *gorm.DB) *gorm.DB {
+		return db.Order("stream_index")
+	}).Preload("Chapters", func(db *gorm.DB) *gorm.DB {
+		return db.Order("start_time")
+	}).Where("id = ?", id).First(&item).Error
+	if err != nil {
 		return item, err
 	}
 	return item, nil
@@ -113,7 +386,7 @@ func (object DBObject) DeleteAll() error {
 		return tx.Error
 	}
 
-	if err := tx.Where("1 = 1").Delete(&MediaItem{}).Error; err != nil {
+	if err := tx.Unscoped().Where("1 = 1").Delete(&MediaItem{}).Error; err != nil {
 		tx.Rollback()
 		return err
 	}
@@ -121,14 +394,108 @@ func (object DBObject) DeleteAll() error {
 	return tx.Commit().Error
 }
 
+// syncJob is a unit of work for the SyncDatabase workers. New files are
+// inserted before being probed; existing ones are only probed.
+type syncJob struct {
+	file  media.MediaFile
+	isNew bool
+}
+
+// SyncDatabase reconciles the media table with the result of a scan: new
+// files are added, rows whose file has disappeared are tombstoned and the
+// rest are left untouched. Every file without technical metadata is probed
+// with ffprobe along the way.
+func (object DBObject) SyncDatabase(mediaFiles *[]media.MediaFile) (SyncReport, error) {
+	return object.syncFiles("", mediaFiles)
+}
+
+// SyncDirectory is SyncDatabase for a scan of dir alone: only media stored
+// at or below dir is considered missing when it isn't in mediaFiles.
+func (object DBObject) SyncDirectory(dir string, mediaFiles *[]media.MediaFile) (SyncReport, error) {
+	return object.syncFiles(filepath.Clean(dir), mediaFiles)
+}
 
-func (object DBObject) SyncDatabase(mediaFiles *[]media.MediaFile) error {
+// syncFiles reconciles the media under dir, or the whole table when dir is
+// empty, with mediaFiles.
+func (object DBObject) syncFiles(dir string, mediaFiles *[]media.MediaFile) (SyncReport, error) {
 	const workerCount = 4
-	jobs := make(chan media.MediaFile, len(*mediaFiles))
-	errChan := make(chan error, len(*mediaFiles))
+	var report SyncReport
+
+	var existing []MediaItem
+	query := object.DB.Select("id", "root", "type", "probed_at")
+	if dir != "" {
+		query = query.Where(pathUnder, dir, likePrefix(dir))
+	}
+	if err := query.Find(&existing).Error; err != nil {
+		return report, err
+	}
+	live := make(map[string]MediaItem, len(existing))
+	for _, item := range existing {
+		live[item.ID] = item
+	}
+	// Items whose media directory changed (or predates the root column).
+	moved := make(map[string][]string)
+	// Items whose kind changed with the config's media kinds.
+	retyped := make(map[string][]string)
+
+	scanned := make(map[string]bool, len(*mediaFiles))
+	toSync := make([]syncJob, 0, len(*mediaFiles))
+	newFiles := 0
+	for _, file := range *mediaFiles {
+		if scanned[file.ID] {
+			continue
+		}
+		scanned[file.ID] = true
+		stored, exists := live[file.ID]
+		if !exists {
+			newFiles++
+			toSync = append(toSync, syncJob{file: file, isNew: true})
+			continue
+		}
+		report.Unchanged++
+		if stored.Root != file.Root {
+			moved[file.Root] = append(moved[file.Root], file.ID)
+		}
+		if stored.Type != file.Type {
+			retyped[file.Type] = append(retyped[file.Type], file.ID)
+		}
+		if stored.ProbedAt == nil {
+			toSync = append(toSync, syncJob{file: file})
+		}
+	}
+	for root, ids := range moved {
+		if err := object.setColumn(ids, "root", root); err != nil {
+			return report, err
+		}
+	}
+	for kind, ids := range retyped {
+		if err := object.setColumn(ids, "type", kind); err != nil {
+			return report, err
+		}
+	}
+
+	jobs := make(chan syncJob, len(toSync))
+	errChan := make(chan error, len(toSync))
 	var wg sync.WaitGroup
 
-	logger.Log().Sugar().Infof("Starting SyncDatabase with %d media files", len(*mediaFiles))
+	progress := SyncProgress{Running: true, Dir: dir, Total: len(toSync)}
+	var progressMu sync.Mutex
+	lastReport := time.Now()
+	object.syncProgress(progress)
+	jobDone := func(added bool) {
+		progressMu.Lock()
+		defer progressMu.Unlock()
+		progress.Done++
+		if added {
+			progress.Added++
+		}
+		if time.Since(lastReport) >= syncProgressInterval {
+			lastReport = time.Now()
+			object.syncProgress(progress)
+		}
+	}
+
+	logger.Log().Sugar().Infof("Starting SyncDatabase with %d media files (%d new)", len(*mediaFiles), newFiles)
 
 	// Start worker goroutines
 	for i := 0; i < workerCount; i++ {
@@ -136,28 +503,32 @@ func (object DBObject) SyncDatabase(mediaFiles *[]media.MediaFile) error {
 		go func(workerID int) {
 			defer wg.Done()
 			logger.Log().Sugar().Infof("Worker %d started", workerID)
-			for media := range jobs {
+			for job := range jobs {
+				media := job.file
 				logger.Log().Sugar().Infof("Worker %d syncing media: %s", workerID, media.ID)
-				err := object.AddMediaItem(&MediaItem{
-					ID:   media.ID,
-					Name: media.Name,
-					Path: media.Path,
-					Ext:  media.Ext,
-				})
-				if err != nil {
-					logger.Log().Sugar().Errorf("Worker %d failed to add media %s: %v", workerID, media.ID, err)
-					errChan <- fmt.Errorf("failed to add %s: %w", media.ID, err)
-				} else {
+				if job.isNew {
+					item := MediaItemFromFile(media)
+					if err := object.AddMediaItem(&item); err != nil {
+						logger.Log().Sugar().Errorf("Worker %d failed to add media %s: %v", workerID, media.ID, err)
+						errChan <- fmt.Errorf("failed to add %s: %w", media.ID, err)
+						jobDone(false)
+						continue
+					}
 					logger.Log().Sugar().Infof("Worker %d successfully added media %s", workerID, media.ID)
 				}
+				// A file ffprobe can't read is still listed, just without metadata.
+				if err := object.ProbeMediaItem(media.ID, media.Path); err != nil {
+					logger.Log().Sugar().Warnf("Worker %d failed to probe media %s: %v", workerID, media.ID, err)
+				}
+				jobDone(job.isNew)
 			}
 			logger.Log().Sugar().Infof("Worker %d finished", workerID)
 		}(i + 1)
 	}
 
-	// Send all media files into the job channel
-	for _, media := range *mediaFiles {
-		jobs <- media
+	// Send all new and unprobed media files into the job channel
+	for _, job := range toSync {
+		jobs <- job
 	}
 	close(jobs)
 	logger.Log().Sugar().Info("All jobs sent, waiting for workers to finish")
@@ -165,16 +536,40 @@ func (object DBObject) SyncDatabase(mediaFiles *[]media.MediaFile) error {
 	// Wait for all workers to finish
 	wg.Wait()
 	close(errChan)
+	// Only files that were actually stored count as added.
+	report.Added = progress.Added
 	logger.Log().Sugar().Info("All workers finished")
 
 	// Check for any errors and return the first one found
 	for err := range errChan {
 		if err != nil {
 			logger.Log().Sugar().Errorf("SyncDatabase error encountered: %v", err)
-			return err
+			progress.Running = false
+			progress.Error = err.Error()
+			object.syncProgress(progress)
+			return report, err
 		}
 	}
 
-	logger.Log().Sugar().Info("SyncDatabase completed successfully without errors")
-	return nil
+	missing := make([]string, 0)
+	for id := range live {
+		if !scanned[id] {
+			missing = append(missing, id)
+		}
+	}
+	removed, err := object.SoftDeleteMediaItems(missing)
+	progress.Running = false
+	progress.Removed = int(removed)
+	if err != nil {
+		progress.Error = err.Error()
+	}
+	object.syncProgress(progress)
+	if err != nil {
+		logger.Log().Sugar().Errorf("SyncDatabase failed to prune missing media: %v", err)
+		return report, err
+	}
+	report.Removed = int(removed)
+
+	logger.Log().Sugar().Infof("SyncDatabase completed: %d added, %d removed, %d unchanged", report.Added, report.Removed, report.Unchanged)
+	return report, nil
 }
@@ -0,0 +1,20 @@
+package database
+
+import "testing"
+
+func TestSqliteDSN(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"media.db", "media.db?_busy_timeout=5000&_txlock=immediate"},
+		{"file:media.db?cache=shared", "file:media.db?_busy_timeout=5000&_txlock=immediate&cache=shared"},
+		{"media.db?_busy_timeout=100", "media.db?_busy_timeout=100&_txlock=immediate"},
+		{"media.db?_timeout=100&_txlock=deferred", "media.db?_timeout=100&_txlock=deferred"},
+	}
+	for _, tt := range tests {
+		if got := sqliteDSN(tt.path); got != tt.want {
+			t.Errorf("sqliteDSN(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
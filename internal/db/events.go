@@ -0,0 +1,66 @@
+package database
+
+import "time"
+
+// syncProgressInterval limits how often SyncDatabase reports progress.
+const syncProgressInterval = 500 * time.Millisecond
+
+// Listener is told about changes to the library, e.g. to push them to
+// connected clients. Calls must not block.
+type Listener interface {
+	MediaAdded(item MediaItem)
+	MediaRemoved(items []MediaItem)
+	SyncProgress(progress SyncProgress)
+}
+
+// Listeners passes every change on to each of its listeners, in order.
+type Listeners []Listener
+
+func (l Listeners) MediaAdded(item MediaItem) {
+	for _, listener := range l {
+		listener.MediaAdded(item)
+	}
+}
+
+func (l Listeners) MediaRemoved(items []MediaItem) {
+	for _, listener := range l {
+		listener.MediaRemoved(items)
+	}
+}
+
+func (l Listeners) SyncProgress(progress SyncProgress) {
+	for _, listener := range l {
+		listener.SyncProgress(progress)
+	}
+}
+
+// SyncProgress describes a running (or just finished) SyncDatabase pass.
+// Total and Done count the files that had to be added or probed. Dir is set
+// when only one directory is being synced, and Error when the sync failed.
+type SyncProgress struct {
+	Running bool   `json:"running"`
+	Dir     string `json:"dir,omitempty"`
+	Total   int    `json:"total"`
+	Done    int    `json:"done"`
+	Added   int    `json:"added"`
+	Removed int    `json:"removed"`
+	Error   string `json:"error,omitempty"`
+}
+
+func (object DBObject) mediaAdded(item MediaItem) {
+	if object.Listener != nil {
+		object.Listener.MediaAdded(item)
+	}
+}
+
+func (object DBObject) mediaRemoved(items []MediaItem) {
+	if object.Listener != nil && len(items) > 0 {
+		object.Listener.MediaRemoved(items)
+	}
+}
+
+func (object DBObject) syncProgress(progress SyncProgress) {
+	if object.Listener != nil {
+		object.Listener.SyncProgress(progress)
+	}
+}
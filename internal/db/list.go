@@ -0,0 +1,236 @@
+package database
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"media_server/internal/media"
+	"slices"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	SortName      = "name"
+	SortDateAdded = "date_added"
+	SortSize      = "size"
+	SortDuration  = "duration"
+
+	OrderAsc  = "asc"
+	OrderDesc = "desc"
+)
+
+// sortColumns maps the public sort keys to their columns.
+var sortColumns = map[string]string{
+	SortName:      "name",
+	SortDateAdded: "created_at",
+	SortSize:      "size",
+	SortDuration:  "duration",
+}
+
+// ListOptions sorts and filters a media listing. Zero values mean no filter
+// and the default sort (name, ascending), except for Access which has to
+// allow the libraries to list.
+type ListOptions struct {
+	Sort   string
+	Order  string
+	Exts   []string
+	Root   string
+	Type   string
+	Access Access
+}
+
+// Normalize fills in defaults and canonicalises the extension filter, and
+// returns an error for unknown sort keys, orders or types.
+func (opts *ListOptions) Normalize() error {
+	if opts.Sort == "" {
+		opts.Sort = SortName
+	}
+	if _, ok := sortColumns[opts.Sort]; !ok {
+		return fmt.Errorf("invalid sort %q, must be one of name, date_added, size, duration", opts.Sort)
+	}
+
+	if opts.Order == "" {
+		opts.Order = OrderAsc
+	}
+	opts.Order = strings.ToLower(opts.Order)
+	if opts.Order != OrderAsc && opts.Order != OrderDesc {
+		return fmt.Errorf("invalid order %q, must be asc or desc", opts.Order)
+	}
+
+	if opts.Type != "" && !media.IsKind(opts.Type) {
+		return fmt.Errorf("invalid type %q, must be one of %s", opts.Type, strings.Join(media.Kinds, ", "))
+	}
+
+	exts := make([]string, 0, len(opts.Exts))
+	for _, ext := range opts.Exts {
+		ext = strings.ToLower(strings.TrimSpace(ext))
+		if ext == "" {
+			continue
+		}
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		exts = append(exts, ext)
+	}
+	opts.Exts = exts
+	return nil
+}
+
+// filter adds the filters of opts to tx.
+func (opts ListOptions) filter(tx *gorm.DB) *gorm.DB {
+	tx = opts.Access.scope(tx)
+	if len(opts.Exts) > 0 {
+		tx = tx.Where("ext IN ?", opts.Exts)
+	}
+	if opts.Root != "" {
+		tx = tx.Where("root = ?", opts.Root)
+	}
+	if opts.Type != "" {
+		tx = tx.Where("type = ?", opts.Type)
+	}
+	return tx
+}
+
+// orderBy returns the ORDER BY clause for opts. The ID breaks ties so the
+// order is stable across pages.
+func (opts ListOptions) orderBy() string {
+	return fmt.Sprintf("%s %s, id %s", sortColumns[opts.Sort], opts.Order, opts.Order)
+}
+
+// ErrInvalidCursor is returned for cursors that are malformed or were issued
+// for a different sort.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// cursor is the decoded form of the opaque tokens handed out for keyset
+// pagination: the sort key and ID of the row to continue from.
+type cursor struct {
+	Sort     string          `json:"s"`
+	Order    string          `json:"o"`
+	Key      json.RawMessage `json:"k"`
+	ID       string          `json:"i"`
+	Backward bool            `json:"b,omitempty"`
+}
+
+func (opts ListOptions) encodeCursor(item MediaItem, backward bool) string {
+	var key interface{}
+	switch opts.Sort {
+	case SortDateAdded:
+		key = item.CreatedAt
+	case SortSize:
+		key = item.Size
+	case SortDuration:
+		key = item.Duration
+	default:
+		key = item.Name
+	}
+	raw, _ := json.Marshal(key)
+	data, _ := json.Marshal(cursor{Sort: opts.Sort, Order: opts.Order, Key: raw, ID: item.ID, Backward: backward})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeCursor parses token and returns the typed sort key it continues
+// from.
+func (opts ListOptions) decodeCursor(token string) (cursor, interface{}, error) {
+	var c cursor
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return c, nil, ErrInvalidCursor
+	}
+	if err := json.Unmarshal(data, &c); err != nil || c.ID == "" {
+		return c, nil, ErrInvalidCursor
+	}
+	if c.Sort != opts.Sort || c.Order != opts.Order {
+		return c, nil, ErrInvalidCursor
+	}
+
+	var key interface{}
+	switch opts.Sort {
+	case SortDateAdded:
+		var t time.Time
+		err = json.Unmarshal(c.Key, &t)
+		key = t
+	case SortSize:
+		var n int64
+		err = json.Unmarshal(c.Key, &n)
+		key = n
+	case SortDuration:
+		var f float64
+		err = json.Unmarshal(c.Key, &f)
+		key = f
+	default:
+		var s string
+		err = json.Unmarshal(c.Key, &s)
+		key = s
+	}
+	if err != nil {
+		return c, nil, ErrInvalidCursor
+	}
+	return c, key, nil
+}
+
+// GetByCursor returns up to count media items following (or, for cursors
+// pointing backwards, preceding) the position encoded in token, using keyset
+// pagination on the sort key and ID. An empty token starts at the beginning.
+// The returned cursors are empty when there is nothing further in that
+// direction. opts must have been normalized.
+func (object DBObject) GetByCursor(token string, count int, opts ListOptions) (items []MediaItem, next string, prev string, err error) {
+	if count < 1 {
+		return nil, "", "", fmt.Errorf("count number can't be less than one\n")
+	}
+
+	column := sortColumns[opts.Sort]
+	tx := opts.filter(object.DB)
+	backward := false
+	if token != "" {
+		c, key, err := opts.decodeCursor(token)
+		if err != nil {
+			return nil, "", "", err
+		}
+		backward = c.Backward
+		cmp := ">"
+		if (opts.Order == OrderDesc) != backward {
+			cmp = "<"
+		}
+		tx = tx.Where(fmt.Sprintf("(%s %s ? OR (%s = ? AND id %s ?))", column, cmp, column, cmp), key, key, c.ID)
+	}
+
+	order := opts.Order
+	if backward {
+		order = map[string]string{OrderAsc: OrderDesc, OrderDesc: OrderAsc}[order]
+	}
+	if err := tx.Order(fmt.Sprintf("%s %s, id %s", column, order, order)).Limit(count + 1).Find(&items).Error; err != nil {
+		return nil, "", "", err
+	}
+
+	hasMore := len(items) > count
+	if hasMore {
+		items = items[:count]
+	}
+	if backward {
+		slices.Reverse(items)
+	}
+	if len(items) == 0 {
+		return items, "", "", nil
+	}
+
+	first, last := items[0], items[len(items)-1]
+	if backward {
+		// We came from the page after this one, so it exists.
+		next = opts.encodeCursor(last, false)
+		if hasMore {
+			prev = opts.encodeCursor(first, true)
+		}
+	} else {
+		if hasMore {
+			next = opts.encodeCursor(last, false)
+		}
+		if token != "" {
+			prev = opts.encodeCursor(first, true)
+		}
+	}
+	return items, next, prev, nil
+}
@@ -0,0 +1,177 @@
+package database
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"media_server/internal/logger"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func newTestDB(t *testing.T) DBObject {
+	t.Helper()
+	logger.InitLogger(false)
+	db := InitDataBase(filepath.Join(t.TempDir(), "media.db"))
+	if db.Err != nil {
+		t.Fatalf("InitDataBase: %v", db.Err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db
+}
+
+func TestCursorRoundTrip(t *testing.T) {
+	created := time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC)
+	item := MediaItem{ID: "abc", Name: "Film.mkv", CreatedAt: created, Size: 1 << 40, Duration: 5400.25}
+
+	tests := []struct {
+		sort string
+		key  interface{}
+	}{
+		{SortName, "Film.mkv"},
+		{SortDateAdded, created},
+		{SortSize, int64(1 << 40)},
+		{SortDuration, 5400.25},
+	}
+	for _, tt := range tests {
+		for _, backward := range []bool{false, true} {
+			t.Run(fmt.Sprintf("%s/backward=%v", tt.sort, backward), func(t *testing.T) {
+				opts := ListOptions{Sort: tt.sort, Order: OrderDesc}
+				c, key, err := opts.decodeCursor(opts.encodeCursor(item, backward))
+				if err != nil {
+					t.Fatalf("decodeCursor: %v", err)
+				}
+				if c.ID != item.ID || c.Backward != backward {
+					t.Errorf("cursor = %+v, want ID %q and Backward %v", c, item.ID, backward)
+				}
+				if got, ok := key.(time.Time); ok {
+					if !got.Equal(tt.key.(time.Time)) {
+						t.Errorf("key = %v, want %v", got, tt.key)
+					}
+				} else if key != tt.key {
+					t.Errorf("key = %#v, want %#v", key, tt.key)
+				}
+			})
+		}
+	}
+}
+
+func rawCursor(data string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(data))
+}
+
+func TestDecodeCursorInvalid(t *testing.T) {
+	byName := ListOptions{Sort: SortName, Order: OrderAsc}
+	item := MediaItem{ID: "abc", Name: "Film.mkv"}
+
+	tests := []struct {
+		name  string
+		opts  ListOptions
+		token string
+	}{
+		{"not base64", byName, "!!!"},
+		{"not json", byName, rawCursor(`not json`)},
+		{"missing id", byName, rawCursor(`{"s":"name","o":"asc","k":"a"}`)},
+		{"other sort", ListOptions{Sort: SortSize, Order: OrderAsc}, byName.encodeCursor(item, false)},
+		{"other order", ListOptions{Sort: SortName, Order: OrderDesc}, byName.encodeCursor(item, false)},
+		{"key of the wrong type", ListOptions{Sort: SortSize, Order: OrderAsc}, rawCursor(`{"s":"size","o":"asc","k":"big","i":"abc"}`)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := tt.opts.decodeCursor(tt.token); !errors.Is(err, ErrInvalidCursor) {
+				t.Errorf("decodeCursor(%q) error = %v, want ErrInvalidCursor", tt.token, err)
+			}
+		})
+	}
+}
+
+func TestGetByCursor(t *testing.T) {
+	db := newTestDB(t)
+	// Sizes and dates repeat, also across page boundaries, so paging has to
+	// break ties on the ID.
+	added := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 7; i++ {
+		item := MediaItem{
+			ID:        fmt.Sprintf("id%d", i),
+			Name:      fmt.Sprintf("item %d", i),
+			Path:      fmt.Sprintf("/media/item%d.mp4", i),
+			Size:      int64(i / 2),
+			CreatedAt: added.Add(time.Duration((i+1)/3) * time.Minute),
+			Type:      "video",
+		}
+		if err := db.DB.Create(&item).Error; err != nil {
+			t.Fatalf("create: %v", err)
+		}
+	}
+
+	tests := []struct {
+		opts ListOptions
+		want []string
+	}{
+		{ListOptions{Sort: SortName, Order: OrderAsc}, []string{"id0", "id1", "id2", "id3", "id4", "id5", "id6"}},
+		{ListOptions{Sort: SortName, Order: OrderDesc}, []string{"id6", "id5", "id4", "id3", "id2", "id1", "id0"}},
+		{ListOptions{Sort: SortSize, Order: OrderAsc}, []string{"id0", "id1", "id2", "id3", "id4", "id5", "id6"}},
+		{ListOptions{Sort: SortSize, Order: OrderDesc}, []string{"id6", "id5", "id4", "id3", "id2", "id1", "id0"}},
+		{ListOptions{Sort: SortDateAdded, Order: OrderAsc}, []string{"id0", "id1", "id2", "id3", "id4", "id5", "id6"}},
+		{ListOptions{Sort: SortDateAdded, Order: OrderDesc}, []string{"id6", "id5", "id4", "id3", "id2", "id1", "id0"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.opts.Sort+"/"+tt.opts.Order, func(t *testing.T) {
+			opts := tt.opts
+			opts.Access = FullAccess
+
+			// Forward through every page.
+			var got []string
+			var prevs []string
+			token := ""
+			for {
+				items, next, prev, err := db.GetByCursor(token, 3, opts)
+				if err != nil {
+					t.Fatalf("GetByCursor(%q): %v", token, err)
+				}
+				for _, item := range items {
+					got = append(got, item.ID)
+				}
+				if (token == "") != (prev == "") {
+					t.Errorf("page after %q: prev = %q", token, prev)
+				}
+				prevs = append(prevs, prev)
+				if next == "" {
+					break
+				}
+				token = next
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("forward = %v, want %v", got, tt.want)
+			}
+
+			// And back from the last page to the first one.
+			got = nil
+			token = prevs[len(prevs)-1]
+			for token != "" {
+				items, next, prev, err := db.GetByCursor(token, 3, opts)
+				if err != nil {
+					t.Fatalf("GetByCursor(%q): %v", token, err)
+				}
+				if next == "" {
+					t.Errorf("page before %q has no next cursor", token)
+				}
+				page := make([]string, 0, len(items))
+				for _, item := range items {
+					page = append(page, item.ID)
+				}
+				got = append(page, got...)
+				token = prev
+			}
+			if want := tt.want[:len(tt.want)-len(tt.want)%3]; !slices.Equal(got, want) {
+				t.Errorf("backward = %v, want %v", got, want)
+			}
+		})
+	}
+}
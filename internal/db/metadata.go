@@ -0,0 +1,105 @@
+package database
+
+import (
+	"media_server/internal/media"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// MediaTrack is an audio or subtitle stream belonging to a MediaItem.
+type MediaTrack struct {
+	ID          uint   `gorm:"primaryKey" json:"-"`
+	MediaID     string `gorm:"index" json:"-"`
+	StreamIndex int    `json:"stream_index"`
+	Kind        string `json:"kind"`
+	Codec       string `json:"codec"`
+	Language    string `json:"language,omitempty"`
+	Title       string `json:"title,omitempty"`
+	Channels    int    `json:"channels,omitempty"`
+	Default     bool   `json:"default"`
+}
+
+// MediaChapter is a chapter marker belonging to a MediaItem, in seconds.
+type MediaChapter struct {
+	ID        uint    `gorm:"primaryKey" json:"-"`
+	MediaID   string  `gorm:"index" json:"-"`
+	Title     string  `json:"title"`
+	StartTime float64 `json:"start"`
+	EndTime   float64 `json:"end"`
+}
+
+// SaveProbe stores the ffprobe metadata for a media item, replacing any
+// tracks and chapters recorded by a previous probe.
+func (object DBObject) SaveProbe(id string, probe *media.ProbeResult) error {
+	now := time.Now()
+	return object.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&MediaItem{ID: id}).Updates(map[string]interface{}{
+			"duration":    probe.Duration,
+			"container":   probe.Container,
+			"video_codec": probe.VideoCodec,
+			"audio_codec": probe.AudioCodec,
+			"width":       probe.Width,
+			"height":      probe.Height,
+			"frame_rate":  probe.FrameRate,
+			"bitrate":     probe.Bitrate,
+			"size":        probe.Size,
+			"direct_play": probe.DirectPlayable(),
+			"probed_at":   &now,
+		}).Error
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Where("media_id = ?", id).Delete(&MediaTrack{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("media_id = ?", id).Delete(&MediaChapter{}).Error; err != nil {
+			return err
+		}
+
+		tracks := make([]MediaTrack, 0, len(probe.Tracks))
+		for _, track := range probe.Tracks {
+			tracks = append(tracks, MediaTrack{
+				MediaID:     id,
+				StreamIndex: track.StreamIndex,
+				Kind:        track.Kind,
+				Codec:       track.Codec,
+				Language:    track.Language,
+				Title:       track.Title,
+				Channels:    track.Channels,
+				Default:     track.Default,
+			})
+		}
+		if len(tracks) > 0 {
+			if err := tx.Create(&tracks).Error; err != nil {
+				return err
+			}
+		}
+
+		chapters := make([]MediaChapter, 0, len(probe.Chapters))
+		for _, chapter := range probe.Chapters {
+			chapters = append(chapters, MediaChapter{
+				MediaID:   id,
+				Title:     chapter.Title,
+				StartTime: chapter.Start,
+				EndTime:   chapter.End,
+			})
+		}
+		if len(chapters) > 0 {
+			if err := tx.Create(&chapters).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// ProbeMediaItem runs ffprobe on the item's file and stores the result.
+func (object DBObject) ProbeMediaItem(id string, path string) error {
+	probe, err := media.Probe(path)
+	if err != nil {
+		return err
+	}
+	return object.SaveProbe(id, probe)
+}
@@ -0,0 +1,98 @@
+package database
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// completedThreshold is the share of the duration after which an item counts
+// as watched.
+const completedThreshold = 0.9
+
+// PlaybackState is a user's watch progress of a media item.
+type PlaybackState struct {
+	UserID       uint       `gorm:"primaryKey;autoIncrement:false" json:"-"`
+	MediaID      string     `gorm:"primaryKey" json:"media_id"`
+	Position     float64    `json:"position"`
+	Completed    bool       `json:"completed"`
+	PlayCount    int        `json:"play_count"`
+	LastPlayedAt time.Time  `gorm:"index" json:"last_played_at"`
+	Media        *MediaItem `gorm:"foreignKey:MediaID;constraint:OnDelete:CASCADE" json:"media,omitempty"`
+}
+
+// GetPlaybackState returns the user's stored progress of a media item, or a
+// zero state if they never played it.
+func (object DBObject) GetPlaybackState(user User, mediaID string) (PlaybackState, error) {
+	state := PlaybackState{UserID: user.ID, MediaID: mediaID}
+	err := object.DB.Where("user_id = ? AND media_id = ?", user.ID, mediaID).First(&state).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return state, nil
+	}
+	return state, err
+}
+
+// ReportProgress records a user's playback position, in seconds, for a media
+// item.
+// Reports arriving less than minInterval after the previous one are dropped
+// unless they change the completed flag; the returned bool tells whether the
+// report was stored. Items outside the user's libraries are reported as not
+// found. An item is completed when the player says so or the
+// position passes 90% of its duration, and each completion counts as a play.
+func (object DBObject) ReportProgress(user User, mediaID string, position float64, completed bool, minInterval time.Duration) (PlaybackState, bool, error) {
+	var state PlaybackState
+	stored := false
+
+	err := object.DB.Transaction(func(tx *gorm.DB) error {
+		var item MediaItem
+		if err := tx.Select("id", "duration", "root").Where("id = ?", mediaID).First(&item).Error; err != nil {
+			return err
+		}
+		if !user.Access().Allows(item.Root) {
+			return gorm.ErrRecordNotFound
+		}
+
+		err := tx.Where("user_id = ? AND media_id = ?", user.ID, mediaID).First(&state).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		isNew := err != nil
+		if isNew {
+			state = PlaybackState{UserID: user.ID, MediaID: mediaID}
+		}
+
+		if item.Duration > 0 && position >= item.Duration*completedThreshold {
+			completed = true
+		}
+		now := time.Now()
+		if !isNew && completed == state.Completed && now.Sub(state.LastPlayedAt) < minInterval {
+			return nil
+		}
+
+		if completed && !state.Completed {
+			state.PlayCount++
+		}
+		state.Position = position
+		state.Completed = completed
+		state.LastPlayedAt = now
+		stored = true
+		return tx.Save(&state).Error
+	})
+	return state, stored, err
+}
+
+// ContinueWatching returns up to limit items the user started but didn't
+// finish, most recently played first, leaving out libraries they can no
+// longer see.
+func (object DBObject) ContinueWatching(user User, limit int) ([]PlaybackState, error) {
+	var states []PlaybackState
+	err := user.Access().scope(object.DB).
+		Joins("JOIN media_items ON media_items.id = playback_states.media_id AND media_items.deleted_at IS NULL").
+		Preload("Media").
+		Where("playback_states.user_id = ? AND playback_states.completed = ? AND playback_states.position > 0", user.ID, false).
+		Order("playback_states.last_played_at DESC").
+		Limit(limit).
+		Find(&states).Error
+	return states, err
+}
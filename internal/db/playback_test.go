@@ -0,0 +1,170 @@
+package database
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func TestReportProgress(t *testing.T) {
+	db := newTestDB(t)
+	item := MediaItem{ID: "film", Name: "Film.mkv", Root: "/films", Duration: 1000}
+	if err := db.DB.Create(&item).Error; err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	user := User{ID: 1, Role: RoleUser, Libraries: []string{"/films"}}
+
+	// minInterval is either long enough to throttle the report or zero, so
+	// the steps don't depend on how fast they run.
+	const throttled, unthrottled = time.Hour, time.Duration(0)
+	steps := []struct {
+		name          string
+		position      float64
+		completed     bool
+		minInterval   time.Duration
+		wantStored    bool
+		wantPosition  float64
+		wantCompleted bool
+		wantPlays     int
+	}{
+		{"first report is stored", 100, false, throttled, true, 100, false, 0},
+		{"report within the window is dropped", 200, false, throttled, false, 100, false, 0},
+		{"report after the window is stored", 300, false, unthrottled, true, 300, false, 0},
+		{"just below 90% isn't completed", 899, false, unthrottled, true, 899, false, 0},
+		{"90% completes, even within the window", 900, false, throttled, true, 900, true, 1},
+		{"still completed past 90%", 950, false, unthrottled, true, 950, true, 1},
+		{"completed report within the window is dropped", 990, true, throttled, false, 950, true, 1},
+		{"rewatching resets completed", 10, false, throttled, true, 10, false, 1},
+		{"player marks it completed", 20, true, throttled, true, 20, true, 2},
+	}
+	for _, step := range steps {
+		state, stored, err := db.ReportProgress(user, item.ID, step.position, step.completed, step.minInterval)
+		if err != nil {
+			t.Fatalf("%s: ReportProgress: %v", step.name, err)
+		}
+		if stored != step.wantStored {
+			t.Errorf("%s: stored = %v, want %v", step.name, stored, step.wantStored)
+		}
+		if state.Position != step.wantPosition || state.Completed != step.wantCompleted || state.PlayCount != step.wantPlays {
+			t.Errorf("%s: state = position %v, completed %v, plays %d; want %v, %v, %d", step.name,
+				state.Position, state.Completed, state.PlayCount, step.wantPosition, step.wantCompleted, step.wantPlays)
+		}
+
+		saved, err := db.GetPlaybackState(user, item.ID)
+		if err != nil {
+			t.Fatalf("%s: GetPlaybackState: %v", step.name, err)
+		}
+		if saved.Position != state.Position || saved.Completed != state.Completed || saved.PlayCount != state.PlayCount {
+			t.Errorf("%s: stored state %+v differs from returned %+v", step.name, saved, state)
+		}
+	}
+}
+
+func TestReportProgressNotFound(t *testing.T) {
+	db := newTestDB(t)
+	items := []MediaItem{
+		{ID: "film", Name: "Film.mkv", Root: "/films", Duration: 1000},
+		{ID: "song", Name: "Song.mp3", Root: "/music", Duration: 200},
+		{ID: "gone", Name: "Gone.mkv", Root: "/films", Duration: 1000},
+	}
+	if err := db.DB.Create(&items).Error; err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if err := db.DB.Delete(&MediaItem{ID: "gone"}).Error; err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	user := User{ID: 1, Role: RoleUser, Libraries: []string{"/films"}}
+	admin := User{ID: 2, Role: RoleAdmin}
+
+	tests := []struct {
+		name    string
+		user    User
+		mediaID string
+		want    error
+	}{
+		{"allowed library", user, "film", nil},
+		{"other library", user, "song", gorm.ErrRecordNotFound},
+		{"admin sees every library", admin, "song", nil},
+		{"removed media", user, "gone", gorm.ErrRecordNotFound},
+		{"unknown media", admin, "missing", gorm.ErrRecordNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := db.ReportProgress(tt.user, tt.mediaID, 10, false, 0)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("ReportProgress error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestContinueWatching(t *testing.T) {
+	db := newTestDB(t)
+	items := []MediaItem{
+		{ID: "a", Name: "A.mkv", Root: "/films"},
+		{ID: "b", Name: "B.mkv", Root: "/films"},
+		{ID: "c", Name: "C.mkv", Root: "/films"},
+		{ID: "d", Name: "D.mp3", Root: "/music"},
+		{ID: "e", Name: "E.mkv", Root: "/films"},
+		{ID: "f", Name: "F.mkv", Root: "/films"},
+	}
+	if err := db.DB.Create(&items).Error; err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if err := db.DB.Delete(&MediaItem{ID: "e"}).Error; err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+
+	now := time.Now()
+	states := []PlaybackState{
+		{UserID: 1, MediaID: "a", Position: 10, LastPlayedAt: now.Add(-3 * time.Hour)},
+		// Finished, so not listed.
+		{UserID: 1, MediaID: "b", Position: 10, Completed: true, LastPlayedAt: now.Add(-time.Minute)},
+		{UserID: 1, MediaID: "c", Position: 10, LastPlayedAt: now.Add(-time.Hour)},
+		// In a library the user can't see.
+		{UserID: 1, MediaID: "d", Position: 10, LastPlayedAt: now.Add(-2 * time.Hour)},
+		// Removed from disk.
+		{UserID: 1, MediaID: "e", Position: 10, LastPlayedAt: now},
+		// Never got past the start.
+		{UserID: 1, MediaID: "f", Position: 0, LastPlayedAt: now},
+		// Someone else's progress.
+		{UserID: 2, MediaID: "a", Position: 10, LastPlayedAt: now},
+	}
+	if err := db.DB.Create(&states).Error; err != nil {
+		t.Fatalf("create states: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		user  User
+		limit int
+		want  []string
+	}{
+		{"user", User{ID: 1, Role: RoleUser, Libraries: []string{"/films"}}, 10, []string{"c", "a"}},
+		{"limit", User{ID: 1, Role: RoleUser, Libraries: []string{"/films"}}, 1, []string{"c"}},
+		{"no libraries", User{ID: 1, Role: RoleUser}, 10, nil},
+		{"admin", User{ID: 1, Role: RoleAdmin}, 10, []string{"c", "d", "a"}},
+		{"other user", User{ID: 2, Role: RoleAdmin}, 10, []string{"a"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			states, err := db.ContinueWatching(tt.user, tt.limit)
+			if err != nil {
+				t.Fatalf("ContinueWatching: %v", err)
+			}
+			var got []string
+			for _, state := range states {
+				if state.Media == nil || state.Media.ID != state.MediaID {
+					t.Errorf("state for %s has media %+v", state.MediaID, state.Media)
+				}
+				got = append(got, state.MediaID)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("ContinueWatching = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package database
+
+import "media_server/internal/media"
+
+const (
+	RenditionReady  = "ready"
+	RenditionFailed = "failed"
+)
+
+const (
+	// StreamModeDirect serves the original file untouched.
+	StreamModeDirect = "direct"
+	// StreamModeTranscode remuxes or transcodes the file while streaming it.
+	StreamModeTranscode = "transcode"
+	// StreamModeRendition serves a rendition transcoded ahead of time.
+	StreamModeRendition = "rendition"
+	// StreamModePending means the item needs a rendition that isn't ready.
+	StreamModePending = "pending"
+	// StreamModeUnavailable means producing a rendition failed.
+	StreamModeUnavailable = "unavailable"
+)
+
+// Playable reports whether the item is video or audio, the only kinds that
+// are transcoded or get renditions.
+func (item *MediaItem) Playable() bool {
+	return item.Type == media.KindVideo || item.Type == media.KindAudio
+}
+
+// ResolveStreamMode fills in StreamMode for the given streaming setting.
+// Items that haven't been probed are served directly, as nothing is known
+// about their codecs, and so are images and subtitles.
+func (item *MediaItem) ResolveStreamMode(onDemand bool) {
+	switch {
+	case !item.Playable() || item.DirectPlay || item.ProbedAt == nil:
+		item.StreamMode = StreamModeDirect
+	case onDemand:
+		item.StreamMode = StreamModeTranscode
+	case item.RenditionStatus == RenditionReady:
+		item.StreamMode = StreamModeRendition
+	case item.RenditionStatus == RenditionFailed:
+		item.StreamMode = StreamModeUnavailable
+	default:
+		item.StreamMode = StreamModePending
+	}
+}
+
+// Remuxable reports whether the item's streams can be copied into an MP4
+// container instead of being transcoded.
+func (item *MediaItem) Remuxable() bool {
+	return media.Remuxable(item.VideoCodec, item.AudioCodec)
+}
+
+// PendingRenditions returns up to limit probed video and audio items that
+// browsers can't play directly and that don't have a rendition yet.
+func (object DBObject) PendingRenditions(limit int) ([]MediaItem, error) {
+	var items []MediaItem
+	err := object.DB.
+		Where("type IN ? AND direct_play = ? AND probed_at IS NOT NULL AND rendition_status = ''",
+			[]string{media.KindVideo, media.KindAudio}, false).
+		Limit(limit).
+		Find(&items).Error
+	return items, err
+}
+
+// SetRendition records the outcome of pre-transcoding an item.
+func (object DBObject) SetRendition(id string, status string, path string) error {
+	return object.DB.Model(&MediaItem{ID: id}).Updates(map[string]interface{}{
+		"rendition_status": status,
+		"rendition_path":   path,
+	}).Error
+}
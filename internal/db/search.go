@@ -0,0 +1,135 @@
+package database
+
+import (
+	"fmt"
+	"media_server/internal/logger"
+	"strings"
+	"unicode"
+
+	"gorm.io/gorm"
+)
+
+// searchValues is the text indexed for every media item (referred to as
+// row): its name, its path (the tokenizer splits it into components) and
+// technical metadata.
+func searchValues(row string) string {
+	return strings.NewReplacer("row.", row+".").Replace(`row.id, row.name, row.path,
+		trim(coalesce(row.container, '') || ' ' || coalesce(row.video_codec, '') || ' ' || coalesce(row.audio_codec, ''))`)
+}
+
+// searchSchema keeps the media_search FTS5 table in sync with media_items.
+// The triggers are recreated on every start so changes to the indexed
+// columns apply to existing databases.
+var searchSchema = []string{
+	`CREATE VIRTUAL TABLE IF NOT EXISTS media_search USING fts5(
+		id UNINDEXED, name, path, metadata,
+		tokenize = 'unicode61 remove_diacritics 2',
+		prefix = '2 3'
+	)`,
+	`DROP TRIGGER IF EXISTS media_search_insert`,
+	`DROP TRIGGER IF EXISTS media_search_update`,
+	`DROP TRIGGER IF EXISTS media_search_delete`,
+	`CREATE TRIGGER media_search_insert AFTER INSERT ON media_items BEGIN
+		INSERT INTO media_search (id, name, path, metadata) VALUES (` + searchValues("new") + `);
+	END`,
+	`CREATE TRIGGER media_search_update AFTER UPDATE OF name, path, container, video_codec, audio_codec ON media_items BEGIN
+		DELETE FROM media_search WHERE id = old.id;
+		INSERT INTO media_search (id, name, path, metadata) VALUES (` + searchValues("new") + `);
+	END`,
+	`CREATE TRIGGER media_search_delete AFTER DELETE ON media_items BEGIN
+		DELETE FROM media_search WHERE id = old.id;
+	END`,
+	// Index rows stored before the search table existed.
+	`INSERT INTO media_search (id, name, path, metadata)
+		SELECT ` + searchValues("media_items") + ` FROM media_items
+		WHERE media_items.id NOT IN (SELECT id FROM media_search)`,
+}
+
+// searchTriggers are the triggers searchSchema creates on media_items.
+var searchTriggers = []string{"media_search_insert", "media_search_update", "media_search_delete"}
+
+// initSearch creates the full-text index. It reports false when SQLite was
+// built without FTS5 (see the sqlite_fts5 build tag), in which case search
+// falls back to LIKE matching.
+func initSearch(db *gorm.DB) bool {
+	err := db.Transaction(func(tx *gorm.DB) error {
+		for _, stmt := range searchSchema {
+			if err := tx.Exec(stmt).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Log().Sugar().Warnf("Full-text search unavailable, falling back to LIKE search: %v", err)
+		// Triggers left by a build with FTS5 would make every write to
+		// media_items fail with "no such module: fts5".
+		for _, trigger := range searchTriggers {
+			if err := db.Exec("DROP TRIGGER IF EXISTS " + trigger).Error; err != nil {
+				logger.Log().Sugar().Errorf("Failed to drop search trigger %s: %v", trigger, err)
+			}
+		}
+		return false
+	}
+	logger.Log().Info("Full-text search index ready")
+	return true
+}
+
+// Search returns a page of media items matching query, best matches first.
+// Every word of the query must match, as a prefix, the name, a path
+// component or the metadata of an item. Only libraries allowed by access are
+// searched.
+func (object DBObject) Search(query string, page int, count int, access Access) (itemList []MediaItem, numberOfElements int, pages int, err error) {
+	if page < 1 {
+		return nil, 0, 0, fmt.Errorf("page number can't be less than one\n")
+	}
+	if count < 1 {
+		return nil, 0, 0, fmt.Errorf("count number can't be less than one\n")
+	}
+
+	terms := searchTerms(query)
+	if len(terms) == 0 {
+		return []MediaItem{}, 0, 0, nil
+	}
+
+	var tx *gorm.DB
+	if object.FullTextSearch {
+		match := make([]string, len(terms))
+		for i, term := range terms {
+			match[i] = `"` + term + `"*`
+		}
+		tx = object.DB.Model(&MediaItem{}).
+			Joins("JOIN media_search ON media_search.id = media_items.id").
+			Where("media_search MATCH ?", strings.Join(match, " ")).
+			Order("media_search.rank")
+	} else {
+		tx = object.DB.Model(&MediaItem{})
+		for _, term := range terms {
+			like := "%" + escapeLike(term) + "%"
+			tx = tx.Where("(media_items.name LIKE ? ESCAPE '\\' OR media_items.path LIKE ? ESCAPE '\\')", like, like)
+		}
+		tx = tx.Order("media_items.name")
+	}
+
+	tx = access.scope(tx)
+
+	var total int64
+	if err := tx.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return nil, 0, 0, err
+	}
+	pageNo := (total + int64(count) - 1) / int64(count)
+
+	var items []MediaItem
+	if err := tx.Select("media_items.*").Limit(count).Offset((page - 1) * count).Find(&items).Error; err != nil {
+		return nil, 0, 0, err
+	}
+	return items, len(items), int(pageNo), nil
+}
+
+// searchTerms splits a user query into words, dropping the punctuation that
+// would otherwise be interpreted as FTS5 query syntax.
+func searchTerms(query string) []string {
+	return strings.FieldsFunc(query, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
@@ -0,0 +1,39 @@
+package database
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Setting is a server-wide value, such as a signing secret, that has to
+// survive restarts.
+type Setting struct {
+	Key   string `gorm:"primaryKey"`
+	Value string `gorm:"not null"`
+}
+
+// SettingOrCreate returns the value stored under key, storing the result of
+// create first if there is none.
+func (object DBObject) SettingOrCreate(key string, create func() (string, error)) (string, error) {
+	var setting Setting
+	err := object.DB.Where("key = ?", key).First(&setting).Error
+	if err == nil {
+		return setting.Value, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", err
+	}
+
+	value, err := create()
+	if err != nil {
+		return "", err
+	}
+	// Another process may have won the race; keep whichever was stored first.
+	if err := object.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&Setting{Key: key, Value: value}).Error; err != nil {
+		return "", err
+	}
+	err = object.DB.Where("key = ?", key).First(&setting).Error
+	return setting.Value, err
+}
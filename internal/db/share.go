@@ -0,0 +1,80 @@
+package database
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ShareLink grants access to a single media item without an account.
+type ShareLink struct {
+	ID        string    `gorm:"primaryKey" json:"id"`
+	MediaID   string    `gorm:"index;not null" json:"media_id"`
+	UserID    uint      `gorm:"index;not null" json:"user_id"`
+	ExpiresAt time.Time `gorm:"index" json:"expires_at"`
+	// MaxUses limits how many times the stream can be started; 0 means no
+	// limit.
+	MaxUses   int       `json:"max_uses"`
+	Uses      int       `json:"uses"`
+	Revoked   bool      `json:"revoked"`
+	CreatedAt time.Time `json:"created_at"`
+
+	// Filled in when the link is created; the signature isn't stored.
+	StreamURL    string `gorm:"-" json:"stream_url,omitempty"`
+	ThumbnailURL string `gorm:"-" json:"thumbnail_url,omitempty"`
+}
+
+// CreateShareLink stores a new share link.
+func (object DBObject) CreateShareLink(link *ShareLink) error {
+	return object.DB.Create(link).Error
+}
+
+// ActiveShareLinks returns every link that hasn't expired or been revoked.
+func (object DBObject) ActiveShareLinks() ([]ShareLink, error) {
+	var links []ShareLink
+	err := object.DB.Where("revoked = ? AND expires_at > ?", false, time.Now()).Find(&links).Error
+	return links, err
+}
+
+// GetShareLinks returns the links created by userID, or every link when
+// userID is 0, newest first.
+func (object DBObject) GetShareLinks(userID uint) ([]ShareLink, error) {
+	tx := object.DB.Order("created_at DESC")
+	if userID != 0 {
+		tx = tx.Where("user_id = ?", userID)
+	}
+	var links []ShareLink
+	err := tx.Find(&links).Error
+	return links, err
+}
+
+// GetShareLink returns a single link.
+func (object DBObject) GetShareLink(id string) (ShareLink, error) {
+	var link ShareLink
+	err := object.DB.Where("id = ?", id).First(&link).Error
+	return link, err
+}
+
+// RevokeShareLink marks a link as revoked.
+func (object DBObject) RevokeShareLink(id string) error {
+	res := object.DB.Model(&ShareLink{}).Where("id = ?", id).Update("revoked", true)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// SetShareLinkUses stores the use counts of several links at once.
+func (object DBObject) SetShareLinkUses(uses map[string]int) error {
+	return object.DB.Transaction(func(tx *gorm.DB) error {
+		for id, count := range uses {
+			if err := tx.Model(&ShareLink{}).Where("id = ?", id).Update("uses", count).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,22 @@
+package database
+
+const (
+	ThumbnailReady  = "ready"
+	ThumbnailFailed = "failed"
+)
+
+// PendingThumbnails returns every item whose thumbnail hasn't been generated
+// or attempted yet.
+func (object DBObject) PendingThumbnails() ([]MediaItem, error) {
+	var items []MediaItem
+	err := object.DB.Where("thumbnail_status = ''").Find(&items).Error
+	return items, err
+}
+
+// SetThumbnailStatus records the outcome of generating an item's thumbnail.
+func (object DBObject) SetThumbnailStatus(id string, status string, errMsg string) error {
+	return object.DB.Model(&MediaItem{ID: id}).Updates(map[string]interface{}{
+		"thumbnail_status": status,
+		"thumbnail_error":  errMsg,
+	}).Error
+}
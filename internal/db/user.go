@@ -0,0 +1,280 @@
+package database
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// SessionTTL is how long a login stays valid.
+const SessionTTL = 30 * 24 * time.Hour
+
+// BootstrapAdmin is the username of the account created on first run.
+const BootstrapAdmin = "admin"
+
+var (
+	ErrInvalidCredentials = errors.New("invalid username or password")
+	ErrInvalidSession     = errors.New("invalid or expired session")
+	ErrUserExists         = errors.New("username already taken")
+	ErrLastAdmin          = errors.New("at least one admin account must remain")
+)
+
+type User struct {
+	ID           uint   `gorm:"primaryKey" json:"id"`
+	Username     string `gorm:"uniqueIndex;not null" json:"username"`
+	PasswordHash string `gorm:"not null" json:"-"`
+	Role         string `gorm:"not null;default:'user'" json:"role" example:"user"`
+	// Libraries lists the media directories a non-admin user may see.
+	Libraries []string  `gorm:"type:text;serializer:json" json:"libraries"`
+	CreatedAt time.Time `json:"created_at"`
+
+	// Scopes limits what the current request may do when it was made with
+	// an API key; nil for sessions, which may do anything the role allows.
+	Scopes []string `gorm:"-" json:"-"`
+}
+
+func (u User) IsAdmin() bool {
+	return u.Role == RoleAdmin
+}
+
+// Access returns the libraries the user may see.
+func (u User) Access() Access {
+	if u.IsAdmin() {
+		return FullAccess
+	}
+	return Access{Roots: u.Libraries}
+}
+
+// Session is a login. Only a hash of its token is stored, so a leaked
+// database can't be used to take over sessions.
+type Session struct {
+	TokenHash string `gorm:"primaryKey"`
+	UserID    uint   `gorm:"index;not null"`
+	User      User   `gorm:"constraint:OnDelete:CASCADE"`
+	CreatedAt time.Time
+	ExpiresAt time.Time `gorm:"index"`
+}
+
+// CreateUser stores a new account with a bcrypt hash of password.
+func (object DBObject) CreateUser(username string, password string, role string, libraries []string) (User, error) {
+	username = strings.TrimSpace(username)
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return User{}, err
+	}
+
+	user := User{Username: username, PasswordHash: string(hash), Role: role, Libraries: libraries}
+	err = object.DB.Transaction(func(tx *gorm.DB) error {
+		var existing int64
+		if err := tx.Model(&User{}).Where("username = ?", username).Count(&existing).Error; err != nil {
+			return err
+		}
+		if existing > 0 {
+			return ErrUserExists
+		}
+		return tx.Create(&user).Error
+	})
+	return user, err
+}
+
+// SetPassword replaces a user's password and ends all of their sessions.
+func (object DBObject) SetPassword(userID uint, password string) error {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	return object.DB.Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&User{ID: userID}).Update("password_hash", string(hash))
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return tx.Where("user_id = ?", userID).Delete(&Session{}).Error
+	})
+}
+
+// UpdateUser changes a user's role and libraries.
+func (object DBObject) UpdateUser(userID uint, role string, libraries []string) (User, error) {
+	var user User
+	err := object.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&user, userID).Error; err != nil {
+			return err
+		}
+		if user.IsAdmin() && role != RoleAdmin {
+			if err := lastAdminCheck(tx); err != nil {
+				return err
+			}
+		}
+		user.Role = role
+		user.Libraries = libraries
+		return tx.Model(&user).Select("role", "libraries").Updates(&user).Error
+	})
+	return user, err
+}
+
+// lastAdminCheck returns ErrLastAdmin when only one admin is left.
+func lastAdminCheck(tx *gorm.DB) error {
+	var admins int64
+	if err := tx.Model(&User{}).Where("role = ?", RoleAdmin).Count(&admins).Error; err != nil {
+		return err
+	}
+	if admins <= 1 {
+		return ErrLastAdmin
+	}
+	return nil
+}
+
+// GetUsers returns every account, ordered by username.
+func (object DBObject) GetUsers() ([]User, error) {
+	var users []User
+	err := object.DB.Order("username").Find(&users).Error
+	return users, err
+}
+
+// DeleteUser removes an account together with its sessions, API keys and
+// watch progress, and revokes its share links.
+func (object DBObject) DeleteUser(userID uint) error {
+	return object.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&Session{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", userID).Delete(&PlaybackState{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", userID).Delete(&APIKey{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&ShareLink{}).Where("user_id = ?", userID).Update("revoked", true).Error; err != nil {
+			return err
+		}
+		var user User
+		if err := tx.First(&user, userID).Error; err != nil {
+			return err
+		}
+		if user.IsAdmin() {
+			if err := lastAdminCheck(tx); err != nil {
+				return err
+			}
+		}
+		res := tx.Delete(&User{}, userID)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	})
+}
+
+// Authenticate checks a username and password and returns the account.
+func (object DBObject) Authenticate(username string, password string) (User, error) {
+	var user User
+	err := object.DB.Where("username = ?", strings.TrimSpace(username)).First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		// Compare anyway so unknown usernames take as long as wrong passwords.
+		bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return user, ErrInvalidCredentials
+	}
+	if err != nil {
+		return user, err
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)) != nil {
+		return user, ErrInvalidCredentials
+	}
+	return user, nil
+}
+
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("dummy password"), bcrypt.DefaultCost)
+
+// CreateSession starts a session for the user and returns its token, which
+// is only ever known to the client.
+func (object DBObject) CreateSession(userID uint) (string, time.Time, error) {
+	token, err := RandomToken()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	session := Session{
+		TokenHash: hashToken(token),
+		UserID:    userID,
+		ExpiresAt: time.Now().Add(SessionTTL),
+	}
+	if err := object.DB.Create(&session).Error; err != nil {
+		return "", time.Time{}, err
+	}
+	return token, session.ExpiresAt, nil
+}
+
+// SessionUser returns the user a session token belongs to.
+func (object DBObject) SessionUser(token string) (User, error) {
+	var session Session
+	err := object.DB.Preload("User").
+		Where("token_hash = ? AND expires_at > ?", hashToken(token), time.Now()).
+		First(&session).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return User{}, ErrInvalidSession
+	}
+	return session.User, err
+}
+
+// DeleteSession ends the session identified by token.
+func (object DBObject) DeleteSession(token string) error {
+	return object.DB.Where("token_hash = ?", hashToken(token)).Delete(&Session{}).Error
+}
+
+// PurgeExpiredSessions removes sessions that can no longer be used.
+func (object DBObject) PurgeExpiredSessions() (int64, error) {
+	res := object.DB.Where("expires_at <= ?", time.Now()).Delete(&Session{})
+	return res.RowsAffected, res.Error
+}
+
+// EnsureAdmin creates the BootstrapAdmin account with a random password when
+// no account exists yet. The password is handed to save before the account
+// is created, so it is never lost; nothing is created if save fails. It
+// reports whether the account was created.
+func (object DBObject) EnsureAdmin(save func(password string) error) (bool, error) {
+	var count int64
+	if err := object.DB.Model(&User{}).Count(&count).Error; err != nil {
+		return false, err
+	}
+	if count > 0 {
+		return false, nil
+	}
+
+	password, err := RandomToken()
+	if err != nil {
+		return false, err
+	}
+	password = password[:16]
+	if err := save(password); err != nil {
+		return false, err
+	}
+	if _, err := object.CreateUser(BootstrapAdmin, password, RoleAdmin, nil); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// RandomToken returns 32 random bytes, hex encoded.
+func RandomToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// hashToken is used instead of bcrypt because tokens are long and random,
+// and they're checked on every request.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
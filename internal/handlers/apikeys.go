@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	database "media_server/internal/db"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type APIKeyRequest struct {
+	Name string `json:"name" example:"backup script"`
+	// Any of read, stream and admin; admin implies the others and is only
+	// available to admins.
+	Scopes []string `json:"scopes" example:"read,stream"`
+}
+
+type APIKeyResponse struct {
+	database.APIKey
+	// The key itself. It is only shown here, once.
+	Key string `json:"key" example:"msk_1a2b3c4d..."`
+}
+
+// ListAPIKeys godoc
+// @Summary      List API keys
+// @Description  Returns the current user's API keys. The keys themselves aren't included. Sessions only.
+// @Tags         auth
+// @Produce      json
+// @Security     BearerAuth
+// @Success      200  {array}   database.APIKey
+// @Failure      401  {object}  handlers.ErrorResponse
+// @Failure      403  {object}  handlers.ErrorResponse
+// @Failure      500  {object}  handlers.ErrorResponse
+// @Router       /auth/keys [get]
+func (h *Handler) ListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	keys, err := h.DB.GetAPIKeys(CurrentUser(r).ID)
+	if err != nil {
+		h.Logger.Error("failed to list API keys", zap.Error(err))
+		writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(keys); err != nil {
+		h.Logger.Error("failed to encode response", zap.Error(err))
+	}
+}
+
+// CreateAPIKey godoc
+// @Summary      Create an API key
+// @Description  Creates a named API key acting for the current user, limited to its scopes. Send it like a session token,
+// @Description  as "Authorization: Bearer <key>", or as the token query parameter where headers can't be set. Sessions of admins and users only.
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        body  body      handlers.APIKeyRequest  true  "Name and scopes"
+// @Success      201   {object}  handlers.APIKeyResponse
+// @Failure      400   {object}  handlers.ErrorResponse
+// @Failure      401   {object}  handlers.ErrorResponse
+// @Failure      403   {object}  handlers.ErrorResponse
+// @Failure      500   {object}  handlers.ErrorResponse
+// @Router       /auth/keys [post]
+func (h *Handler) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	var req APIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if strings.TrimSpace(req.Name) == "" {
+		writeError(w, http.StatusBadRequest, "name is required")
+		return
+	}
+	if len(req.Scopes) == 0 {
+		writeError(w, http.StatusBadRequest, "at least one scope is required")
+		return
+	}
+
+	user := CurrentUser(r)
+	scopes := make([]string, 0, len(req.Scopes))
+	for _, scope := range req.Scopes {
+		if !database.ValidScope(scope) {
+			writeError(w, http.StatusBadRequest, "invalid scope "+strconv.Quote(scope)+", must be read, stream or admin")
+			return
+		}
+		if scope == database.ScopeAdmin && !user.IsAdmin() {
+			writeError(w, http.StatusForbidden, "only admins can create admin keys")
+			return
+		}
+		if !contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+
+	key, token, err := h.DB.CreateAPIKey(user.ID, req.Name, scopes)
+	if err != nil {
+		h.Logger.Error("failed to create API key", zap.Error(err))
+		writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+	h.Logger.Info("API key created", zap.String("username", user.Username), zap.String("name", key.Name), zap.Strings("scopes", scopes))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(APIKeyResponse{APIKey: key, Key: token}); err != nil {
+		h.Logger.Error("failed to encode response", zap.Error(err))
+	}
+}
+
+// DeleteAPIKey godoc
+// @Summary      Revoke an API key
+// @Description  Deletes one of the current user's API keys; it stops working immediately. Sessions only.
+// @Tags         auth
+// @Security     BearerAuth
+// @Param        id   path  int  true  "API key ID"
+// @Success      204
+// @Failure      400  {object}  handlers.ErrorResponse
+// @Failure      401  {object}  handlers.ErrorResponse
+// @Failure      403  {object}  handlers.ErrorResponse
+// @Failure      404  {object}  handlers.ErrorResponse
+// @Failure      500  {object}  handlers.ErrorResponse
+// @Router       /auth/keys/{id} [delete]
+func (h *Handler) DeleteAPIKey(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid key id")
+		return
+	}
+
+	if err := h.DB.DeleteAPIKey(CurrentUser(r).ID, uint(id)); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			writeError(w, http.StatusNotFound, "API key not found")
+			return
+		}
+		h.Logger.Error("failed to delete API key", zap.Error(err))
+		writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
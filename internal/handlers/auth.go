@@ -0,0 +1,252 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	database "media_server/internal/db"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// minPasswordLength is the shortest password accepted for an account.
+const minPasswordLength = 8
+
+type contextKey int
+
+const (
+	userKey contextKey = iota
+	shareKey
+)
+
+type LoginRequest struct {
+	Username string `json:"username" example:"admin"`
+	Password string `json:"password" example:"correct horse battery staple"`
+}
+
+type LoginResponse struct {
+	Token     string        `json:"token"`
+	ExpiresAt time.Time     `json:"expires_at"`
+	User      database.User `json:"user"`
+}
+
+type PasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+// RequireAuth rejects requests without a valid session token or API key and
+// makes the user behind it available to the handlers behind it. The token is
+// read from the Authorization header. API keys may also be given as the token
+// query parameter, for players and websockets that can't set headers; session
+// tokens may not, as URLs end up in browser history, logs and Referer headers.
+func (h *Handler) RequireAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := requestToken(r)
+		if token == "" {
+			if r.URL.Query().Has("token") {
+				writeError(w, http.StatusUnauthorized, "only API keys may be passed as the token parameter, send session tokens in the Authorization header")
+				return
+			}
+			writeError(w, http.StatusUnauthorized, "authentication required")
+			return
+		}
+
+		var user database.User
+		var err error
+		if strings.HasPrefix(token, database.APIKeyPrefix) {
+			user, err = h.DB.APIKeyUser(token)
+		} else {
+			user, err = h.DB.SessionUser(token)
+		}
+		if err != nil {
+			if !errors.Is(err, database.ErrInvalidSession) && !errors.Is(err, database.ErrInvalidAPIKey) {
+				h.Logger.Error("failed to look up credentials", zap.Error(err))
+			}
+			writeError(w, http.StatusUnauthorized, "invalid or expired credentials")
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), userKey, user)))
+	})
+}
+
+// RequireScope rejects API key requests whose key lacks scope. Sessions
+// always pass. It must run after RequireAuth.
+func (h *Handler) RequireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !CurrentUser(r).HasScope(scope) {
+				writeError(w, http.StatusForbidden, "API key lacks the "+scope+" scope")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireSession rejects requests made with an API key, for endpoints that
+// manage the account itself. It must run after RequireAuth.
+func (h *Handler) RequireSession(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if CurrentUser(r).Scopes != nil {
+			writeError(w, http.StatusForbidden, "not available to API keys")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requestToken returns the bearer token sent with r, if any: the one in the
+// Authorization header, or else an API key given as the token query
+// parameter.
+func requestToken(r *http.Request) string {
+	if header := r.Header.Get("Authorization"); header != "" {
+		scheme, token, found := strings.Cut(header, " ")
+		if found && strings.EqualFold(scheme, "Bearer") {
+			return strings.TrimSpace(token)
+		}
+		return ""
+	}
+	return queryAPIKey(r)
+}
+
+// queryAPIKey returns the token query parameter of r if it holds an API key.
+func queryAPIKey(r *http.Request) string {
+	if token := r.URL.Query().Get("token"); strings.HasPrefix(token, database.APIKeyPrefix) {
+		return token
+	}
+	return ""
+}
+
+// CurrentUser returns the user RequireAuth attached to the request.
+func CurrentUser(r *http.Request) database.User {
+	user, _ := r.Context().Value(userKey).(database.User)
+	return user
+}
+
+// Login godoc
+// @Summary      Log in
+// @Description  Checks a username and password and starts a session. Send the returned token as "Authorization: Bearer <token>";
+// @Description  unlike API keys, session tokens are not accepted as the token query parameter.
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        body  body      handlers.LoginRequest  true  "Credentials"
+// @Success      200   {object}  handlers.LoginResponse
+// @Failure      400   {object}  handlers.ErrorResponse
+// @Failure      401   {object}  handlers.ErrorResponse
+// @Failure      500   {object}  handlers.ErrorResponse
+// @Router       /auth/login [post]
+func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
+	var req LoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	user, err := h.DB.Authenticate(req.Username, req.Password)
+	if err != nil {
+		if errors.Is(err, database.ErrInvalidCredentials) {
+			writeError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+		h.Logger.Error("failed to authenticate", zap.Error(err))
+		writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+
+	token, expiresAt, err := h.DB.CreateSession(user.ID)
+	if err != nil {
+		h.Logger.Error("failed to create session", zap.Error(err))
+		writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+	h.Logger.Info("user logged in", zap.String("username", user.Username))
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(LoginResponse{Token: token, ExpiresAt: expiresAt, User: user}); err != nil {
+		h.Logger.Error("failed to encode response", zap.Error(err))
+	}
+}
+
+// Logout godoc
+// @Summary      Log out
+// @Description  Ends the session the request was made with.
+// @Tags         auth
+// @Security     BearerAuth
+// @Success      204
+// @Failure      401  {object}  handlers.ErrorResponse
+// @Failure      500  {object}  handlers.ErrorResponse
+// @Router       /auth/logout [post]
+func (h *Handler) Logout(w http.ResponseWriter, r *http.Request) {
+	if err := h.DB.DeleteSession(requestToken(r)); err != nil {
+		h.Logger.Error("failed to delete session", zap.Error(err))
+		writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Me godoc
+// @Summary      Get current user
+// @Description  Returns the account the request is authenticated as.
+// @Tags         auth
+// @Produce      json
+// @Security     BearerAuth
+// @Success      200  {object}  database.User
+// @Failure      401  {object}  handlers.ErrorResponse
+// @Router       /auth/me [get]
+func (h *Handler) Me(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(CurrentUser(r)); err != nil {
+		h.Logger.Error("failed to encode response", zap.Error(err))
+	}
+}
+
+// ChangePassword godoc
+// @Summary      Change password
+// @Description  Replaces the current user's password. Every session of the user, including this one, is ended. Not available to guests.
+// @Tags         auth
+// @Accept       json
+// @Security     BearerAuth
+// @Param        body  body  handlers.PasswordRequest  true  "Current and new password"
+// @Success      204
+// @Failure      400  {object}  handlers.ErrorResponse
+// @Failure      401  {object}  handlers.ErrorResponse
+// @Failure      403  {object}  handlers.ErrorResponse
+// @Failure      500  {object}  handlers.ErrorResponse
+// @Router       /auth/password [put]
+func (h *Handler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	var req PasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if len(req.NewPassword) < minPasswordLength {
+		writeError(w, http.StatusBadRequest, "password must be at least "+strconv.Itoa(minPasswordLength)+" characters")
+		return
+	}
+
+	user := CurrentUser(r)
+	if _, err := h.DB.Authenticate(user.Username, req.CurrentPassword); err != nil {
+		if errors.Is(err, database.ErrInvalidCredentials) {
+			writeError(w, http.StatusUnauthorized, "current password is wrong")
+			return
+		}
+		h.Logger.Error("failed to authenticate", zap.Error(err))
+		writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+
+	if err := h.DB.SetPassword(user.ID, req.NewPassword); err != nil {
+		h.Logger.Error("failed to set password", zap.Error(err))
+		writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
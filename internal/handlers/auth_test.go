@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequestToken(t *testing.T) {
+	tests := []struct {
+		name   string
+		url    string
+		header string
+		want   string
+	}{
+		{"bearer header", "/media/all", "Bearer abc123", "abc123"},
+		{"bearer header, any case", "/media/all", "bearer abc123", "abc123"},
+		{"other scheme", "/media/all", "Basic abc123", ""},
+		{"header wins over the query", "/media/all?token=msk_key", "Bearer abc123", "abc123"},
+		{"API key in the query", "/media/x/stream?token=msk_key", "", "msk_key"},
+		{"session token in the query", "/media/x/stream?token=abc123", "", ""},
+		{"nothing", "/media/all", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", tt.url, nil)
+			if tt.header != "" {
+				r.Header.Set("Authorization", tt.header)
+			}
+			if got := requestToken(r); got != tt.want {
+				t.Errorf("requestToken = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithQueryToken(t *testing.T) {
+	playlist := "#EXTM3U\n#EXT-X-TARGETDURATION:6\n0.ts\n1.ts\n"
+	tests := []struct {
+		name string
+		url  string
+		want string
+	}{
+		{"API key", "/media/x/hls/index.m3u8?token=msk_key", "#EXTM3U\n#EXT-X-TARGETDURATION:6\n0.ts?token=msk_key\n1.ts?token=msk_key\n"},
+		{"session token", "/media/x/hls/index.m3u8?token=abc123", playlist},
+		{"no token", "/media/x/hls/index.m3u8", playlist},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", tt.url, nil)
+			if got := withQueryToken(r, playlist); got != tt.want {
+				t.Errorf("withQueryToken = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,248 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"media_server/internal/media"
+	"net/http"
+	"syscall"
+
+	"go.uber.org/zap"
+)
+
+// errSaveConfig is returned by the config operations when the config
+// couldn't be written.
+var errSaveConfig = errors.New("failed to save config")
+
+type FolderRequest struct {
+	Folder string `json:"folder" example:"/srv/media/films"`
+}
+
+// FolderErrorResponse explains why a folder can't be added. Reason is one of
+// empty, not_found, not_directory, not_readable, already_added, nested or
+// contains; Conflict is the media directory it overlaps with.
+type FolderErrorResponse struct {
+	Error    string `json:"error" example:"/srv/media/films is inside the media directory /srv/media"`
+	Reason   string `json:"reason" example:"nested"`
+	Conflict string `json:"conflict,omitempty" example:"/srv/media"`
+}
+
+// addFolder validates folder and adds it to the media directories, which
+// gets it scanned. Invalid folders are reported as a *media.FolderError.
+func (h *Handler) addFolder(folder string) (*media.Config, error) {
+	cfg, _, err := h.Config.AddMediaDir(folder)
+	return cfg, h.configUpdateError(err)
+}
+
+// removeFolder removes folder from the media directories, which gets its
+// media purged.
+func (h *Handler) removeFolder(folder string) (*media.Config, error) {
+	cfg, err := h.Config.RemoveMediaDir(folder)
+	return cfg, h.configUpdateError(err)
+}
+
+// toggleStream flips between on-demand streaming and pre-transcoding.
+func (h *Handler) toggleStream() (*media.Config, error) {
+	cfg, err := h.Config.ToggleStreamOnDemand()
+	return cfg, h.configUpdateError(err)
+}
+
+// browse lists the subdirectories of path for picking a media directory.
+func (h *Handler) browse(path string) (media.Listing, error) {
+	return h.Config.Get().Browse(path)
+}
+
+// configUpdateError logs and hides the errors of a config update that
+// aren't the client's fault.
+func (h *Handler) configUpdateError(err error) error {
+	var folderErr *media.FolderError
+	if err == nil || errors.As(err, &folderErr) || errors.Is(err, media.ErrMediaDirNotFound) {
+		return err
+	}
+	h.Logger.Error("failed to save config", zap.Error(err))
+	return errSaveConfig
+}
+
+// configError converts an error of the config operations to a websocket
+// error.
+func configError(err error) WSError {
+	var folderErr *media.FolderError
+	switch {
+	case errors.As(err, &folderErr):
+		code := WSErrInvalidFolder
+		switch folderErr.Reason {
+		case media.ReasonEmpty:
+			code = WSErrInvalidPayload
+		case media.ReasonExists:
+			code = WSErrFolderExists
+		}
+		return WSError{Code: code, Message: err.Error(), Details: folderErr}
+	case errors.Is(err, media.ErrMediaDirNotFound):
+		return WSError{Code: WSErrFolderNotFound, Message: err.Error()}
+	case errors.Is(err, fs.ErrNotExist), errors.Is(err, fs.ErrPermission), errors.Is(err, syscall.ENOTDIR):
+		return WSError{Code: WSErrBrowseFailed, Message: browseErrorMessage(err)}
+	default:
+		return WSError{Code: WSErrConfig, Message: err.Error()}
+	}
+}
+
+// writeConfigError answers a REST request with an error of the config
+// operations.
+func writeConfigError(w http.ResponseWriter, err error) {
+	var folderErr *media.FolderError
+	switch {
+	case errors.As(err, &folderErr):
+		status := http.StatusBadRequest
+		if folderErr.Reason == media.ReasonExists {
+			status = http.StatusConflict
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(FolderErrorResponse{Error: err.Error(), Reason: folderErr.Reason, Conflict: folderErr.Conflict})
+	case errors.Is(err, media.ErrMediaDirNotFound), errors.Is(err, fs.ErrNotExist):
+		writeError(w, http.StatusNotFound, browseErrorMessage(err))
+	case errors.Is(err, fs.ErrPermission):
+		writeError(w, http.StatusForbidden, browseErrorMessage(err))
+	case errors.Is(err, syscall.ENOTDIR):
+		writeError(w, http.StatusBadRequest, browseErrorMessage(err))
+	default:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// browseErrorMessage describes a filesystem error of browse without the
+// operation name os adds.
+func browseErrorMessage(err error) string {
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		return pathErr.Path + ": " + pathErr.Err.Error()
+	}
+	return err.Error()
+}
+
+func (h *Handler) writeConfig(w http.ResponseWriter, cfg *media.Config) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(cfg); err != nil {
+		h.Logger.Error("failed to encode response", zap.Error(err))
+	}
+}
+
+// GetConfig godoc
+// @Summary      Get config
+// @Description  Admins only. The same as the fetch_config websocket event.
+// @Tags         config
+// @Produce      json
+// @Security     BearerAuth
+// @Success      200  {object}  media.Config
+// @Failure      401  {object}  handlers.ErrorResponse
+// @Failure      403  {object}  handlers.ErrorResponse
+// @Router       /config [get]
+func (h *Handler) GetConfig(w http.ResponseWriter, r *http.Request) {
+	h.writeConfig(w, h.Config.Get())
+}
+
+// AddFolder godoc
+// @Summary      Add a media directory
+// @Description  Admins only. The same as the add_folder websocket event. The directory must exist, be readable and not
+// @Description  overlap another media directory; it is stored as an absolute path with symlinks resolved. It is then
+// @Description  scanned in the background, with progress sent to websocket clients as scan_progress events.
+// @Tags         config
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        body  body      handlers.FolderRequest  true  "Directory to add"
+// @Success      200   {object}  media.Config
+// @Failure      400   {object}  handlers.FolderErrorResponse
+// @Failure      401   {object}  handlers.ErrorResponse
+// @Failure      403   {object}  handlers.ErrorResponse
+// @Failure      409   {object}  handlers.FolderErrorResponse
+// @Failure      500   {object}  handlers.ErrorResponse
+// @Router       /config/folders [post]
+func (h *Handler) AddFolder(w http.ResponseWriter, r *http.Request) {
+	var req FolderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	cfg, err := h.addFolder(req.Folder)
+	if err != nil {
+		writeConfigError(w, err)
+		return
+	}
+	h.writeConfig(w, cfg)
+}
+
+// RemoveFolder godoc
+// @Summary      Remove a media directory
+// @Description  Admins only. The same as the remove_folder websocket event: the directory's media is removed from the
+// @Description  library in the background.
+// @Tags         config
+// @Produce      json
+// @Security     BearerAuth
+// @Param        folder  query     string  true  "Directory to remove, as configured or as it was added"
+// @Success      200     {object}  media.Config
+// @Failure      400     {object}  handlers.FolderErrorResponse
+// @Failure      401     {object}  handlers.ErrorResponse
+// @Failure      403     {object}  handlers.ErrorResponse
+// @Failure      404     {object}  handlers.ErrorResponse
+// @Failure      500     {object}  handlers.ErrorResponse
+// @Router       /config/folders [delete]
+func (h *Handler) RemoveFolder(w http.ResponseWriter, r *http.Request) {
+	cfg, err := h.removeFolder(r.URL.Query().Get("folder"))
+	if err != nil {
+		writeConfigError(w, err)
+		return
+	}
+	h.writeConfig(w, cfg)
+}
+
+// ToggleStream godoc
+// @Summary      Toggle on-demand streaming
+// @Description  Admins only. The same as the toggle_stream websocket event: switches on_demand between transcoding while
+// @Description  streaming and pre-transcoding.
+// @Tags         config
+// @Produce      json
+// @Security     BearerAuth
+// @Success      200  {object}  media.Config
+// @Failure      401  {object}  handlers.ErrorResponse
+// @Failure      403  {object}  handlers.ErrorResponse
+// @Failure      500  {object}  handlers.ErrorResponse
+// @Router       /config/toggle_stream [post]
+func (h *Handler) ToggleStream(w http.ResponseWriter, r *http.Request) {
+	cfg, err := h.toggleStream()
+	if err != nil {
+		writeConfigError(w, err)
+		return
+	}
+	h.writeConfig(w, cfg)
+}
+
+// Browse godoc
+// @Summary      Browse server directories
+// @Description  Admins only. Lists the subdirectories of a directory on the server, to pick media directories from.
+// @Description  The same as the browse websocket event. Hidden directories are left out.
+// @Tags         config
+// @Produce      json
+// @Security     BearerAuth
+// @Param        path  query     string  false  "Directory to list, the filesystem root by default"
+// @Success      200   {object}  media.Listing
+// @Failure      400   {object}  handlers.ErrorResponse
+// @Failure      401   {object}  handlers.ErrorResponse
+// @Failure      403   {object}  handlers.ErrorResponse
+// @Failure      404   {object}  handlers.ErrorResponse
+// @Failure      500   {object}  handlers.ErrorResponse
+// @Router       /config/browse [get]
+func (h *Handler) Browse(w http.ResponseWriter, r *http.Request) {
+	listing, err := h.browse(r.URL.Query().Get("path"))
+	if err != nil {
+		writeConfigError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(listing); err != nil {
+		h.Logger.Error("failed to encode response", zap.Error(err))
+	}
+}
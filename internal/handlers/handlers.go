@@ -1,28 +1,37 @@
 package handlers
 
 import (
-	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
 	database "media_server/internal/db"
+	"media_server/internal/hub"
 	"media_server/internal/logger"
 	"media_server/internal/media"
+	"media_server/internal/share"
+	"media_server/internal/thumbnail"
+	"media_server/internal/transcode"
 	"net/http"
 	"os"
+	"path/filepath"
 	"strconv"
-	"sync"
+	"strings"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/gorilla/websocket"
-	ffmpeg "github.com/u2takey/ffmpeg-go"
 	"go.uber.org/zap"
 	"gorm.io/gorm"
 )
 
 type Handler struct {
-	DB     *database.DBObject
-	Logger *zap.Logger
+	DB           *database.DBObject
+	Logger       *zap.Logger
+	Transcoder   *transcode.Manager
+	Thumbnails   *thumbnail.Cache
+	Pregenerator *thumbnail.Pregenerator
+	Shares       *share.Manager
+	Hub          *hub.Hub
+	Config       *media.ConfigStore
 }
 
 type PaginatedResponse struct {
@@ -31,12 +40,29 @@ type PaginatedResponse struct {
 	Pages            int                  `json:"pages"`
 	Page             int                  `json:"page"`
 	Count            int                  `json:"count"`
+	Sort             string               `json:"sort,omitempty" example:"name"`
+	Order            string               `json:"order,omitempty" example:"asc"`
+	Ext              []string             `json:"ext,omitempty"`
+	Root             string               `json:"root,omitempty"`
+	Type             string               `json:"type,omitempty" example:"video"`
+	// Set in cursor mode only, where Page and Pages are not computed.
+	NextCursor string `json:"next_cursor,omitempty"`
+	PrevCursor string `json:"prev_cursor,omitempty"`
 }
 
 type ErrorResponse struct {
 	Error string `json:"error" example:"internal server error"`
 }
+
+// writeError sends message as an ErrorResponse JSON body.
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(ErrorResponse{Error: message})
+}
+
 type WSMessage struct {
+	ID    string          `json:"id,omitempty"`
 	Event string          `json:"event"`
 	Data  json.RawMessage `json:"data"`
 }
@@ -50,16 +76,19 @@ type ConfigFolderPayload struct {
 // @Description  Retrieves all media items from the database.
 // @Tags         media
 // @Produce      json
+// @Security     BearerAuth
 // @Success      200  {array}   database.MediaItem
+// @Failure      401  {object}  handlers.ErrorResponse
 // @Failure      500  {object}  handlers.ErrorResponse
 // @Router       /media/all [get]
 func (h *Handler) GetAll(w http.ResponseWriter, r *http.Request) {
-	items, err := h.DB.GetAll()
+	items, err := h.DB.GetAll(CurrentUser(r).Access())
 	if err != nil {
 		h.Logger.Error("failed to fetch media", zap.Error(err))
 		http.Error(w, "internal server error", http.StatusInternalServerError)
 		return
 	}
+	h.resolveStreamModes(items)
 
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(items); err != nil {
@@ -70,25 +99,96 @@ func (h *Handler) GetAll(w http.ResponseWriter, r *http.Request) {
 
 // GetPaginatedHandler godoc
 // @Summary      Get paginated media items
-// @Description  Retrieves media items with pagination.
+// @Description  Retrieves media items with pagination, sorting and filtering.
+// @Description  Passing cursor (empty for the first page) switches to keyset pagination: page is ignored, no total is computed,
+// @Description  and next/prev cursors are returned in the body and as rel="next"/rel="prev" links in the Link header.
 // @Tags         media
 // @Produce      json
-// @Param        page   query     int  false  "Page number, default 1"
-// @Param        count  query     int  false  "Number of items per page, default 10"
-// @Success      200    {object}  PaginatedResponse
-// @Failure      400    {object}  handlers.ErrorResponse
-// @Failure      500    {object}  handlers.ErrorResponse
+// @Security     BearerAuth
+// @Param        page    query     int     false  "Page number, default 1"
+// @Param        count   query     int     false  "Number of items per page, default 10"
+// @Param        sort    query     string  false  "Sort key, default name"  Enums(name, date_added, size, duration)
+// @Param        order   query     string  false  "Sort order, default asc"  Enums(asc, desc)
+// @Param        ext     query     string  false  "Comma-separated extensions to include, e.g. mp4,mkv"
+// @Param        root    query     string  false  "Only include media under this configured media directory"
+// @Param        type    query     string  false  "Only include this kind of media"  Enums(video, audio, image, subtitle)
+// @Param        cursor  query     string  false  "Opaque cursor from a previous response; enables cursor mode"
+// @Success      200     {object}  PaginatedResponse
+// @Header       200     {string}  Link    "Next/prev page links in cursor mode"
+// @Failure      400     {object}  handlers.ErrorResponse
+// @Failure      401     {object}  handlers.ErrorResponse
+// @Failure      500     {object}  handlers.ErrorResponse
 // @Router       /media/paginated [get]
 func (h *Handler) GetPaginatedHandler(w http.ResponseWriter, r *http.Request) {
-	page := 1
-	count := 10
+	page, count, err := parsePageParams(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	opts, err := h.parseListOptions(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	resp := PaginatedResponse{
+		Count: count,
+		Sort:  opts.Sort,
+		Order: opts.Order,
+		Ext:   opts.Exts,
+		Root:  opts.Root,
+		Type:  opts.Type,
+	}
+
+	if r.URL.Query().Has("cursor") {
+		items, next, prev, err := h.DB.GetByCursor(r.URL.Query().Get("cursor"), count, opts)
+		if errors.Is(err, database.ErrInvalidCursor) {
+			writeError(w, http.StatusBadRequest, "Invalid cursor parameter")
+			return
+		}
+		if err != nil {
+			h.Logger.Error("Failed to get media by cursor", zap.Error(err))
+			writeError(w, http.StatusInternalServerError, "Failed to get media")
+			return
+		}
+		resp.Items = items
+		resp.NumberOfElements = len(items)
+		resp.NextCursor = next
+		resp.PrevCursor = prev
+		setCursorLinks(w, r, next, prev)
+	} else {
+		items, numberOfElements, pages, err := h.DB.GetPaginated(page, count, opts)
+		if err != nil {
+			h.Logger.Error("Failed to get paginated media", zap.Error(err))
+			writeError(w, http.StatusInternalServerError, "Failed to get media")
+			return
+		}
+		resp.Items = items
+		resp.NumberOfElements = numberOfElements
+		resp.Pages = pages
+		resp.Page = page
+	}
+	h.resolveStreamModes(resp.Items)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		h.Logger.Error("Failed to encode response", zap.Error(err))
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+	}
+}
+
+// parsePageParams reads the page and count query parameters, defaulting to
+// the first page of 10 items.
+func parsePageParams(r *http.Request) (page int, count int, err error) {
+	page = 1
+	count = 10
 
 	if p := r.URL.Query().Get("page"); p != "" {
 		if parsed, err := strconv.Atoi(p); err == nil && parsed > 0 {
 			page = parsed
 		} else {
-			http.Error(w, "Invalid page parameter", http.StatusBadRequest)
-			return
+			return 0, 0, errors.New("Invalid page parameter")
 		}
 	}
 
@@ -96,17 +196,89 @@ func (h *Handler) GetPaginatedHandler(w http.ResponseWriter, r *http.Request) {
 		if parsed, err := strconv.Atoi(c); err == nil && parsed > 0 {
 			count = parsed
 		} else {
-			http.Error(w, "Invalid count parameter", http.StatusBadRequest)
-			return
+			return 0, 0, errors.New("Invalid count parameter")
+		}
+	}
+	return page, count, nil
+}
+
+// setCursorLinks advertises the neighbouring pages in the Link header, using
+// the request URL with only the cursor replaced.
+func setCursorLinks(w http.ResponseWriter, r *http.Request, next string, prev string) {
+	var links []string
+	for _, link := range []struct{ rel, cursor string }{{"next", next}, {"prev", prev}} {
+		if link.cursor == "" {
+			continue
 		}
+		query := r.URL.Query()
+		query.Set("cursor", link.cursor)
+		links = append(links, fmt.Sprintf(`<%s?%s>; rel="%s"`, r.URL.Path, query.Encode(), link.rel))
+	}
+	if len(links) > 0 {
+		w.Header().Set("Link", strings.Join(links, ", "))
+	}
+}
+
+// parseListOptions reads and validates the sort and filter query parameters
+// of a listing.
+func (h *Handler) parseListOptions(r *http.Request) (database.ListOptions, error) {
+	query := r.URL.Query()
+	opts := database.ListOptions{
+		Sort:   query.Get("sort"),
+		Order:  query.Get("order"),
+		Type:   query.Get("type"),
+		Access: CurrentUser(r).Access(),
+	}
+	if ext := query.Get("ext"); ext != "" {
+		opts.Exts = strings.Split(ext, ",")
+	}
+	if err := opts.Normalize(); err != nil {
+		return opts, err
 	}
 
-	items, numberOfElements, pages, err := h.DB.GetPaginated(page, count)
+	if root := query.Get("root"); root != "" {
+		opts.Root = filepath.Clean(root)
+		if h.Config.Get().RootFor(opts.Root) != opts.Root {
+			return opts, fmt.Errorf("invalid root %q, must be one of the configured media directories", root)
+		}
+	}
+	return opts, nil
+}
+
+// SearchHandler godoc
+// @Summary      Search media items
+// @Description  Full-text search over media names, path components and metadata. Every word must match (as a prefix); best matches come first.
+// @Tags         media
+// @Produce      json
+// @Security     BearerAuth
+// @Param        q      query     string  true   "Search query"
+// @Param        page   query     int     false  "Page number, default 1"
+// @Param        count  query     int     false  "Number of items per page, default 10"
+// @Success      200    {object}  PaginatedResponse
+// @Failure      400    {object}  handlers.ErrorResponse
+// @Failure      401    {object}  handlers.ErrorResponse
+// @Failure      500    {object}  handlers.ErrorResponse
+// @Router       /media/search [get]
+func (h *Handler) SearchHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query().Get("q")
+	if query == "" {
+		writeError(w, http.StatusBadRequest, "missing q parameter")
+		return
+	}
+
+	page, count, err := parsePageParams(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	items, numberOfElements, pages, err := h.DB.Search(query, page, count, CurrentUser(r).Access())
 	if err != nil {
-		h.Logger.Error("Failed to get paginated media", zap.Error(err))
-		http.Error(w, "Failed to get media", http.StatusInternalServerError)
+		h.Logger.Error("Failed to search media", zap.Error(err))
+		writeError(w, http.StatusInternalServerError, "Failed to search media")
 		return
 	}
+	h.resolveStreamModes(items)
 
 	resp := PaginatedResponse{
 		Items:            items,
@@ -119,18 +291,19 @@ func (h *Handler) GetPaginatedHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(resp); err != nil {
 		h.Logger.Error("Failed to encode response", zap.Error(err))
-		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
 	}
 }
 
 // GetByID godoc
 // @Summary      Get media item by ID
-// @Description  Returns a single media item by its unique ID.
+// @Description  Returns a single media item by its unique ID, including the technical metadata (duration, codecs, resolution, tracks and chapters) extracted by ffprobe.
 // @Tags         media
 // @Produce      json
+// @Security     BearerAuth
 // @Param        id   path      string  true  "Media Item ID"
 // @Success      200  {object}  database.MediaItem
 // @Failure      400  {object}  handlers.ErrorResponse
+// @Failure      401  {object}  handlers.ErrorResponse
 // @Failure      404  {object}  handlers.ErrorResponse
 // @Failure      500  {object}  handlers.ErrorResponse
 // @Router       /media/{id} [get]
@@ -141,7 +314,7 @@ func (h *Handler) GetByID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	mediaItem, err := h.DB.GetByID(id)
+	mediaItem, err := h.visibleMediaItem(r, id)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			http.Error(w, "media item not found", http.StatusNotFound)
@@ -150,6 +323,7 @@ func (h *Handler) GetByID(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "internal server error", http.StatusInternalServerError)
 		return
 	}
+	mediaItem.ResolveStreamMode(h.streamOnDemand())
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
@@ -161,14 +335,25 @@ func (h *Handler) GetByID(w http.ResponseWriter, r *http.Request) {
 
 // StreamMedia godoc
 // @Summary      Stream media file by ID
-// @Description  Streams the media file to the client supporting range requests.
+// @Description  Streams the media item according to its stream_mode. Files browsers can play are served directly with range support.
+// @Description  Otherwise, with on_demand enabled the file is remuxed or transcoded to fragmented MP4 while streaming (seek with start),
+// @Description  and with on_demand disabled the rendition pre-transcoded by the background job is served once ready.
 // @Tags         media
 // @Produce      video/mp4
-// @Param        id   path      string  true  "Media Item ID"
-// @Success      200  {file}    binary
-// @Failure      400  {object}  handlers.ErrorResponse
-// @Failure      404  {object}  handlers.ErrorResponse
-// @Failure      500  {object}  handlers.ErrorResponse
+// @Security     BearerAuth
+// @Param        id     path      string  true   "Media Item ID"
+// @Param        start  query     number  false  "Start offset in seconds, transcode mode only"
+// @Param        share  query     string  false  "Share link ID; with exp and sig, replaces authentication"
+// @Param        exp    query     int     false  "Share link expiry (unix time)"
+// @Param        sig    query     string  false  "Share link signature"
+// @Success      200    {file}    binary
+// @Failure      400    {object}  handlers.ErrorResponse
+// @Failure      401    {object}  handlers.ErrorResponse
+// @Failure      403    {object}  handlers.ErrorResponse
+// @Failure      404    {object}  handlers.ErrorResponse
+// @Failure      410    {object}  handlers.ErrorResponse
+// @Failure      500    {object}  handlers.ErrorResponse
+// @Failure      503    {object}  handlers.ErrorResponse
 // @Router       /media/{id}/stream [get]
 func (h *Handler) StreamMedia(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
@@ -177,7 +362,7 @@ func (h *Handler) StreamMedia(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	mediaItem, err := h.DB.GetByID(id)
+	mediaItem, err := h.visibleMediaItem(r, id)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			http.Error(w, "media item not found", http.StatusNotFound)
@@ -187,7 +372,54 @@ func (h *Handler) StreamMedia(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	file, err := os.Open(mediaItem.Path)
+	mediaItem.ResolveStreamMode(h.streamOnDemand())
+	w.Header().Set("X-Stream-Mode", mediaItem.StreamMode)
+
+	switch mediaItem.StreamMode {
+	case database.StreamModeDirect:
+		serveFile(w, r, mediaItem.Name, mediaItem.Path)
+	case database.StreamModeRendition:
+		serveFile(w, r, mediaItem.Name, mediaItem.RenditionPath)
+	case database.StreamModeTranscode:
+		start := 0.0
+		if s := r.URL.Query().Get("start"); s != "" {
+			parsed, err := strconv.ParseFloat(s, 64)
+			if err != nil || parsed < 0 {
+				http.Error(w, "Invalid start parameter", http.StatusBadRequest)
+				return
+			}
+			start = parsed
+		}
+		w.Header().Set("Content-Type", "video/mp4")
+		w.Header().Set("Accept-Ranges", "none")
+		err := transcode.StreamMP4(r.Context(), w, mediaItem.Path, start, mediaItem.Remuxable())
+		if err != nil && r.Context().Err() == nil {
+			h.Logger.Error("transcode stream failed", zap.String("id", id), zap.Error(err))
+		}
+	case database.StreamModePending:
+		w.Header().Set("Retry-After", "60")
+		http.Error(w, "media is still being transcoded", http.StatusServiceUnavailable)
+	default:
+		http.Error(w, "media can't be streamed", http.StatusInternalServerError)
+	}
+}
+
+// visibleMediaItem loads a media item, reporting items outside the caller's
+// libraries as gorm.ErrRecordNotFound so their existence isn't revealed.
+// Items opened through a share link are always visible.
+func (h *Handler) visibleMediaItem(r *http.Request, id string) (database.MediaItem, error) {
+	mediaItem, err := h.DB.GetByID(id)
+	if shared, _ := r.Context().Value(shareKey).(string); shared == id {
+		return mediaItem, err
+	}
+	if err == nil && !CurrentUser(r).Access().Allows(mediaItem.Root) {
+		return database.MediaItem{}, gorm.ErrRecordNotFound
+	}
+	return mediaItem, err
+}
+
+func serveFile(w http.ResponseWriter, r *http.Request, name string, path string) {
+	file, err := os.Open(path)
 	if err != nil {
 		http.Error(w, "failed to open media file", http.StatusInternalServerError)
 		return
@@ -200,70 +432,150 @@ func (h *Handler) StreamMedia(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	http.ServeContent(w, r, mediaItem.Name, fi.ModTime(), file)
+	http.ServeContent(w, r, name, fi.ModTime(), file)
+}
+
+// streamOnDemand reports the current on_demand setting.
+func (h *Handler) streamOnDemand() bool {
+	return h.Config.Get().StreamOnDemand
+}
+
+func (h *Handler) resolveStreamModes(items []database.MediaItem) {
+	onDemand := h.streamOnDemand()
+	for i := range items {
+		items[i].ResolveStreamMode(onDemand)
+	}
 }
 
 // ThumbnailHandler godoc
 // @Summary      Get thumbnail image for media
-// @Description  Extracts and returns a JPEG thumbnail from the media file at 4 seconds.
+// @Description  Returns a thumbnail taken from the media file, by default a full-size JPEG at 4 seconds. Thumbnails are cached on disk and revalidated with ETags.
+// @Description  Offsets past the end of the media fall back to the first frame.
+// @Description  Files a thumbnail can't be generated for answer 404 (see thumbnail_status on the media item) so clients can show a placeholder.
 // @Tags         media
 // @Produce      image/jpeg
-// @Param        id   path      string  true  "Media Item ID"
-// @Success      200  {file}    binary
-// @Failure      404  {object}  handlers.ErrorResponse
-// @Failure      500  {object}  handlers.ErrorResponse
+// @Produce      image/png
+// @Produce      image/webp
+// @Security     BearerAuth
+// @Param        id      path      string  true   "Media Item ID"
+// @Param        width   query     int     false  "Thumbnail width in pixels, keeps the aspect ratio if height is omitted"
+// @Param        height  query     int     false  "Thumbnail height in pixels, keeps the aspect ratio if width is omitted"
+// @Param        at      query     number  false  "Offset as a percentage (0-100) of the media duration"
+// @Param        format  query     string  false  "Image format"  Enums(jpeg, png, webp)
+// @Param        share   query     string  false  "Share link ID; with exp and sig, replaces authentication"
+// @Param        exp     query     int     false  "Share link expiry (unix time)"
+// @Param        sig     query     string  false  "Share link signature"
+// @Success      200     {file}    binary
+// @Success      304     "Not modified"
+// @Failure      400     {object}  handlers.ErrorResponse
+// @Failure      401     {object}  handlers.ErrorResponse
+// @Failure      403     {object}  handlers.ErrorResponse
+// @Failure      404     {object}  handlers.ErrorResponse
+// @Failure      410     {object}  handlers.ErrorResponse
+// @Failure      500     {object}  handlers.ErrorResponse
 // @Router       /media/{id}/thumbnail [get]
 func (h *Handler) ThumbnailHandler(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 
-	mediaItem, err := h.DB.GetByID(id)
+	opts, err := parseThumbnailOptions(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	mediaItem, err := h.visibleMediaItem(r, id)
 	if err != nil {
 		http.Error(w, "media not found", http.StatusNotFound)
 		return
 	}
+	if mediaItem.ThumbnailStatus == database.ThumbnailFailed {
+		writeError(w, http.StatusNotFound, "thumbnail unavailable")
+		return
+	}
 
-	if _, err := os.Stat(mediaItem.Path); os.IsNotExist(err) {
+	fi, err := os.Stat(mediaItem.Path)
+	if os.IsNotExist(err) {
 		http.Error(w, "file not found", http.StatusNotFound)
 		return
 	}
+	if err != nil {
+		http.Error(w, "failed to get file info", http.StatusInternalServerError)
+		return
+	}
+
+	etag := `"` + thumbnail.Key(mediaItem.ID, fi.ModTime(), opts) + `"`
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "private, max-age=86400")
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
 
-	imgBytes, err := extractFrameAt4s(mediaItem.Path)
+	imgBytes, err := thumbnail.Get(h.DB, h.Thumbnails, mediaItem, opts)
 	if err != nil {
 		logger.Log().Sugar().Errorf("failed to extract thumbnail: %v \n", err)
-		http.Error(w, "failed to generate thumbnail", http.StatusInternalServerError)
+		writeError(w, http.StatusNotFound, "failed to generate thumbnail")
 		return
 	}
 
-	w.Header().Set("Content-Type", "image/jpeg")
+	w.Header().Set("Content-Type", opts.ContentType())
 	w.WriteHeader(http.StatusOK)
 	w.Write(imgBytes)
 }
 
-func extractFrameAt4s(videoPath string) ([]byte, error) {
-	buf := bytes.NewBuffer(nil)
+// maxThumbnailSize bounds the width and height a client may ask for.
+const maxThumbnailSize = 3840
 
-	err := ffmpeg.Input(videoPath, ffmpeg.KwArgs{"ss": "4"}).
-		Output("pipe:", ffmpeg.KwArgs{
-			"vframes": "1",
-			"format":  "mjpeg",
-		}).
-		WithOutput(buf, os.Stderr).
-		Run()
-	if err != nil {
-		return nil, fmt.Errorf("ffmpeg-go error: %w", err)
+func parseThumbnailOptions(r *http.Request) (thumbnail.Options, error) {
+	opts := thumbnail.DefaultOptions()
+	query := r.URL.Query()
+
+	for name, target := range map[string]*int{"width": &opts.Width, "height": &opts.Height} {
+		value := query.Get(name)
+		if value == "" {
+			continue
+		}
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > maxThumbnailSize {
+			return opts, fmt.Errorf("invalid %s parameter, must be between 1 and %d", name, maxThumbnailSize)
+		}
+		*target = parsed
 	}
 
-	return buf.Bytes(), nil
-}
+	if at := query.Get("at"); at != "" {
+		parsed, err := strconv.ParseFloat(at, 64)
+		if err != nil || parsed < 0 || parsed > 100 {
+			return opts, errors.New("invalid at parameter, must be a percentage between 0 and 100")
+		}
+		opts.Percent = parsed
+	}
 
-var configMutex sync.Mutex
+	switch format := query.Get("format"); format {
+	case "":
+	case "jpg", thumbnail.FormatJPEG:
+		opts.Format = thumbnail.FormatJPEG
+	case thumbnail.FormatPNG, thumbnail.FormatWebP:
+		opts.Format = format
+	default:
+		return opts, errors.New("invalid format parameter, must be jpeg, png or webp")
+	}
+	return opts, nil
+}
 
-func saveConfig(cfg *media.Config) error {
-	data, err := json.MarshalIndent(cfg, "", "  ")
-	if err != nil {
-		return err
+// ThumbnailProgress godoc
+// @Summary      Get thumbnail pre-generation progress
+// @Description  Reports the progress of the background job generating thumbnails for newly scanned media.
+// @Tags         media
+// @Produce      json
+// @Security     BearerAuth
+// @Success      200  {object}  thumbnail.Progress
+// @Failure      401  {object}  handlers.ErrorResponse
+// @Router       /thumbnails/progress [get]
+func (h *Handler) ThumbnailProgress(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(h.Pregenerator.Progress()); err != nil {
+		h.Logger.Error("failed to encode response", zap.Error(err))
 	}
-	return os.WriteFile(media.GetConfigPath(), data, 0644)
 }
 
 func contains(slice []string, target string) bool {
@@ -275,155 +587,127 @@ func contains(slice []string, target string) bool {
 	return false
 }
 
+func (h *Handler) handlePing(reply wsReply) {
+	reply.Send("pong", "ok")
+}
 
-func (h *Handler) handlePing(conn *websocket.Conn, send func(event string, data interface{})) {
-    send("pong", "ok")
+func (h *Handler) handleFetchConfig(reply wsReply) {
+	reply.Send("config_data", h.Config.Get())
 }
 
-func (h *Handler) handleFetchConfig(send func(event string, data interface{})) {
-    configMutex.Lock()
-    defer configMutex.Unlock()
+func (h *Handler) handleAddFolder(data json.RawMessage, reply wsReply) {
+	var payload struct {
+		Folder string `json:"folder"`
+	}
+	if err := json.Unmarshal(data, &payload); err != nil {
+		reply.Error(WSErrInvalidPayload, "invalid payload")
+		return
+	}
 
-    cfg, err := media.LoadConfig()
-    if err != nil {
-        send("error", "failed to load config")
-        return
-    }
-    send("config_data", cfg)
+	cfg, err := h.addFolder(payload.Folder)
+	if err != nil {
+		reply.Fail(configError(err))
+		return
+	}
+	reply.Send("config_updated", cfg)
 }
 
-func (h *Handler) handleAddFolder(data json.RawMessage, send func(event string, data interface{})) {
-    configMutex.Lock()
-    defer configMutex.Unlock()
-
-    cfg, err := media.LoadConfig()
-    if err != nil {
-        send("error", "failed to load config")
-        return
-    }
-
-    var payload struct {
-        Folder string `json:"folder"`
-    }
-    if err := json.Unmarshal(data, &payload); err != nil {
-        send("error", "invalid payload")
-        return
-    }
-
-    if contains(cfg.MediaDirs, payload.Folder) {
-        send("error", "folder already exists")
-        return
-    }
-
-    cfg.MediaDirs = append(cfg.MediaDirs, payload.Folder)
-
-    if err := saveConfig(cfg); err != nil {
-        send("error", "failed to save config")
-        return
-    }
-    send("config_updated", cfg)
-}
+func (h *Handler) handleRemoveFolder(data json.RawMessage, reply wsReply) {
+	var payload struct {
+		Folder string `json:"folder"`
+	}
+	if err := json.Unmarshal(data, &payload); err != nil {
+		reply.Error(WSErrInvalidPayload, "invalid payload")
+		return
+	}
 
-func (h *Handler) handleRemoveFolder(data json.RawMessage, send func(event string, data interface{})) {
-    configMutex.Lock()
-    defer configMutex.Unlock()
-
-    cfg, err := media.LoadConfig()
-    if err != nil {
-        send("error", "failed to load config")
-        return
-    }
-
-    var payload struct {
-        Folder string `json:"folder"`
-    }
-    if err := json.Unmarshal(data, &payload); err != nil {
-        send("error", "invalid payload")
-        return
-    }
-
-    newDirs := make([]string, 0, len(cfg.MediaDirs))
-    found := false
-    for _, f := range cfg.MediaDirs {
-        if f == payload.Folder {
-            found = true
-        } else {
-            newDirs = append(newDirs, f)
-        }
-    }
-    if !found {
-        send("error", "folder not found")
-        return
-    }
-    cfg.MediaDirs = newDirs
-
-    if err := saveConfig(cfg); err != nil {
-        send("error", "failed to save config")
-        return
-    }
-    send("config_updated", cfg)
+	cfg, err := h.removeFolder(payload.Folder)
+	if err != nil {
+		reply.Fail(configError(err))
+		return
+	}
+	reply.Send("config_updated", cfg)
 }
 
-func (h *Handler) handleToggleStream(send func(event string, data interface{})) {
-    configMutex.Lock()
-    defer configMutex.Unlock()
-
-    cfg, err := media.LoadConfig()
-    if err != nil {
-        send("error", "failed to load config")
-        return
-    }
+func (h *Handler) handleBrowse(data json.RawMessage, reply wsReply) {
+	var payload struct {
+		Path string `json:"path"`
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &payload); err != nil {
+			reply.Error(WSErrInvalidPayload, "invalid payload")
+			return
+		}
+	}
 
-    cfg.StreamOnDemand = !cfg.StreamOnDemand
+	listing, err := h.browse(payload.Path)
+	if err != nil {
+		reply.Fail(configError(err))
+		return
+	}
+	reply.Send("browse_data", listing)
+}
 
-    if err := saveConfig(cfg); err != nil {
-        send("error", "failed to save config")
-        return
-    }
-    send("config_updated", cfg)
+func (h *Handler) handleToggleStream(reply wsReply) {
+	cfg, err := h.toggleStream()
+	if err != nil {
+		reply.Fail(configError(err))
+		return
+	}
+	reply.Send("config_updated", cfg)
 }
 
+// MediaConfigWS serves a config websocket for user. Only admins may use the
+// config events, and API keys need the admin scope for them. The connection
+// is registered with the hub, so it also receives the library and config
+// changes the user may see.
+//
+// Requests may carry an id, which is echoed in the reply. Clients start on
+// protocol version 1 and can move to a newer one with a hello event.
+func (h *Handler) MediaConfigWS(conn *websocket.Conn, user database.User) {
+	client := h.Hub.Register(conn, user)
+	defer client.Close()
+
+	version := MinWSProtocolVersion
+
+	for {
+		var msg WSMessage
+		if err := conn.ReadJSON(&msg); err != nil {
+			h.Logger.Warn("WebSocket read error", zap.Error(err))
+			break
+		}
 
+		reply := wsReply{client: client, id: msg.ID, structured: version >= 2 || msg.ID != ""}
 
-func (h *Handler) MediaConfigWS(conn *websocket.Conn) {
-    defer conn.Close()
+		if msg.Event != "ping" && msg.Event != "hello" && !(user.IsAdmin() && user.HasScope(database.ScopeAdmin)) {
+			reply.Error(WSErrForbidden, "admin role required")
+			continue
+		}
 
-    send := func(event string, data interface{}) {
-        msg := map[string]interface{}{
-            "event": event,
-            "data":  data,
-        }
-        if err := conn.WriteJSON(msg); err != nil {
-            h.Logger.Warn("Failed to send WS response", zap.Error(err))
-        }
-    }
+		switch msg.Event {
+		case "hello":
+			version = negotiate(msg.Data, version, reply)
 
-    for {
-        var msg WSMessage
-        if err := conn.ReadJSON(&msg); err != nil {
-            h.Logger.Warn("WebSocket read error", zap.Error(err))
-            break
-        }
+		case "ping":
+			h.handlePing(reply)
 
-        switch msg.Event {
-        case "ping":
-            h.handlePing(conn, send)
+		case "fetch_config":
+			h.handleFetchConfig(reply)
 
-        case "fetch_config":
-            h.handleFetchConfig(send)
+		case "add_folder":
+			h.handleAddFolder(msg.Data, reply)
 
-        case "add_folder":
-            h.handleAddFolder(msg.Data, send)
+		case "remove_folder":
+			h.handleRemoveFolder(msg.Data, reply)
 
-        case "remove_folder":
-            h.handleRemoveFolder(msg.Data, send)
+		case "toggle_stream":
+			h.handleToggleStream(reply)
 
-        case "toggle_stream":
-            h.handleToggleStream(send)
+		case "browse":
+			h.handleBrowse(msg.Data, reply)
 
-        default:
-            send("error", "unknown event")
-        }
-    }
+		default:
+			reply.Error(WSErrUnknownEvent, "unknown event")
+		}
+	}
 }
-
@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"errors"
+	database "media_server/internal/db"
+	"media_server/internal/transcode"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// HLSMasterPlaylist godoc
+// @Summary      Get HLS master playlist
+// @Description  Returns the HLS master playlist for a media item. Segments are transcoded to H.264/AAC on demand.
+// @Description  When authenticated with an API key as the token query parameter, the playlists pass it on to the URIs they list.
+// @Tags         media
+// @Produce      application/vnd.apple.mpegurl
+// @Security     BearerAuth
+// @Param        id   path      string  true  "Media Item ID"
+// @Success      200  {string}  string
+// @Failure      401  {object}  handlers.ErrorResponse
+// @Failure      404  {object}  handlers.ErrorResponse
+// @Failure      500  {object}  handlers.ErrorResponse
+// @Router       /media/{id}/hls/master.m3u8 [get]
+func (h *Handler) HLSMasterPlaylist(w http.ResponseWriter, r *http.Request) {
+	mediaItem, ok := h.hlsMediaItem(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Write([]byte(withQueryToken(r, transcode.MasterPlaylist(mediaItem.Width, mediaItem.Height, mediaItem.Bitrate))))
+}
+
+// HLSMediaPlaylist godoc
+// @Summary      Get HLS media playlist
+// @Description  Returns the VOD playlist listing every segment of the media item.
+// @Tags         media
+// @Produce      application/vnd.apple.mpegurl
+// @Security     BearerAuth
+// @Param        id   path      string  true  "Media Item ID"
+// @Success      200  {string}  string
+// @Failure      401  {object}  handlers.ErrorResponse
+// @Failure      404  {object}  handlers.ErrorResponse
+// @Failure      500  {object}  handlers.ErrorResponse
+// @Router       /media/{id}/hls/index.m3u8 [get]
+func (h *Handler) HLSMediaPlaylist(w http.ResponseWriter, r *http.Request) {
+	mediaItem, ok := h.hlsMediaItem(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Write([]byte(withQueryToken(r, transcode.MediaPlaylist(mediaItem.Duration))))
+}
+
+// HLSSegment godoc
+// @Summary      Get HLS segment
+// @Description  Returns a single MPEG-TS segment, starting the transcoder at that position if it isn't already close to it.
+// @Tags         media
+// @Produce      video/mp2t
+// @Security     BearerAuth
+// @Param        id     path      string  true  "Media Item ID"
+// @Param        index  path      int     true  "Segment index"
+// @Success      200    {file}    binary
+// @Failure      400    {object}  handlers.ErrorResponse
+// @Failure      401    {object}  handlers.ErrorResponse
+// @Failure      404    {object}  handlers.ErrorResponse
+// @Failure      500    {object}  handlers.ErrorResponse
+// @Router       /media/{id}/hls/{index}.ts [get]
+func (h *Handler) HLSSegment(w http.ResponseWriter, r *http.Request) {
+	index, err := strconv.Atoi(chi.URLParam(r, "index"))
+	if err != nil {
+		http.Error(w, "invalid segment index", http.StatusBadRequest)
+		return
+	}
+
+	mediaItem, ok := h.hlsMediaItem(w, r)
+	if !ok {
+		return
+	}
+
+	path, err := h.Transcoder.Segment(r.Context(), mediaItem.ID, mediaItem.Path, mediaItem.Duration, index)
+	if err != nil {
+		if errors.Is(err, transcode.ErrSegmentOutOfRange) {
+			http.Error(w, "segment not found", http.StatusNotFound)
+			return
+		}
+		if r.Context().Err() != nil {
+			return
+		}
+		h.Logger.Error("failed to produce segment", zap.String("id", mediaItem.ID), zap.Int("index", index), zap.Error(err))
+		http.Error(w, "failed to produce segment", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "video/mp2t")
+	http.ServeFile(w, r, path)
+}
+
+// withQueryToken adds the API key given as the request's token query
+// parameter to every URI in playlist, so players that authenticated through
+// the URL (and can't send headers) can fetch what the playlist points at.
+func withQueryToken(r *http.Request, playlist string) string {
+	token := queryAPIKey(r)
+	if token == "" {
+		return playlist
+	}
+	suffix := "?" + url.Values{"token": {token}}.Encode()
+
+	lines := strings.Split(playlist, "\n")
+	for i, line := range lines {
+		if line != "" && !strings.HasPrefix(line, "#") {
+			lines[i] = line + suffix
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// hlsMediaItem loads the media item for an HLS request, probing it first if
+// its duration isn't known yet. It writes the error response itself and
+// returns false when the request can't be served.
+func (h *Handler) hlsMediaItem(w http.ResponseWriter, r *http.Request) (database.MediaItem, bool) {
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		http.Error(w, "missing id parameter", http.StatusBadRequest)
+		return database.MediaItem{}, false
+	}
+
+	mediaItem, err := h.visibleMediaItem(r, id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			http.Error(w, "media item not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+		}
+		return mediaItem, false
+	}
+
+	if mediaItem.Duration <= 0 {
+		if err := h.DB.ProbeMediaItem(mediaItem.ID, mediaItem.Path); err != nil {
+			h.Logger.Error("failed to probe media", zap.String("id", id), zap.Error(err))
+			http.Error(w, "failed to read media duration", http.StatusInternalServerError)
+			return mediaItem, false
+		}
+		if mediaItem, err = h.DB.GetByID(id); err != nil {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return mediaItem, false
+		}
+	}
+	return mediaItem, true
+}
@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// progressInterval is the minimum time between two stored progress reports
+// for the same media; players report more often than that is worth writing.
+const progressInterval = 10 * time.Second
+
+// defaultContinueCount is how many items the continue watching list returns
+// when count is not given.
+const defaultContinueCount = 20
+
+type ProgressRequest struct {
+	// Playback position in seconds.
+	Position float64 `json:"position" example:"754.2"`
+	// Set when the player reached the end; otherwise inferred at 90% of the duration.
+	Completed bool `json:"completed"`
+}
+
+// GetProgress godoc
+// @Summary      Get watch progress
+// @Description  Returns the current user's playback state of a media item. Items they never played return a zero state.
+// @Tags         playback
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id   path      string  true  "Media Item ID"
+// @Success      200  {object}  database.PlaybackState
+// @Failure      401  {object}  handlers.ErrorResponse
+// @Failure      404  {object}  handlers.ErrorResponse
+// @Failure      500  {object}  handlers.ErrorResponse
+// @Router       /media/{id}/progress [get]
+func (h *Handler) GetProgress(w http.ResponseWriter, r *http.Request) {
+	// Like ReportProgress, answer 404 for media that is gone or outside the
+	// user's libraries rather than a zero state.
+	mediaItem, err := h.visibleMediaItem(r, chi.URLParam(r, "id"))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			writeError(w, http.StatusNotFound, "media item not found")
+			return
+		}
+		h.Logger.Error("failed to load media item", zap.Error(err))
+		writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+
+	state, err := h.DB.GetPlaybackState(CurrentUser(r), mediaItem.ID)
+	if err != nil {
+		h.Logger.Error("failed to load playback state", zap.Error(err))
+		writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(state); err != nil {
+		h.Logger.Error("failed to encode response", zap.Error(err))
+	}
+}
+
+// ReportProgress godoc
+// @Summary      Report watch progress
+// @Description  Stores the current user's playback position of a media item. Players should report every 10 seconds or so;
+// @Description  reports arriving sooner after the last stored one are ignored unless they mark the item completed.
+// @Description  The stored state is returned either way, with 202 instead of 200 when the report was ignored. Not available to guests.
+// @Tags         playback
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id    path      string                    true  "Media Item ID"
+// @Param        body  body      handlers.ProgressRequest  true  "Playback position"
+// @Success      200   {object}  database.PlaybackState
+// @Success      202   {object}  database.PlaybackState
+// @Failure      400   {object}  handlers.ErrorResponse
+// @Failure      401   {object}  handlers.ErrorResponse
+// @Failure      403   {object}  handlers.ErrorResponse
+// @Failure      404   {object}  handlers.ErrorResponse
+// @Failure      500   {object}  handlers.ErrorResponse
+// @Router       /media/{id}/progress [put]
+func (h *Handler) ReportProgress(w http.ResponseWriter, r *http.Request) {
+	var req ProgressRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if req.Position < 0 {
+		writeError(w, http.StatusBadRequest, "position must not be negative")
+		return
+	}
+
+	state, stored, err := h.DB.ReportProgress(CurrentUser(r), chi.URLParam(r, "id"), req.Position, req.Completed, progressInterval)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			writeError(w, http.StatusNotFound, "media item not found")
+			return
+		}
+		h.Logger.Error("failed to store playback progress", zap.Error(err))
+		writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if !stored {
+		w.WriteHeader(http.StatusAccepted)
+	}
+	if err := json.NewEncoder(w).Encode(state); err != nil {
+		h.Logger.Error("failed to encode response", zap.Error(err))
+	}
+}
+
+// ContinueWatching godoc
+// @Summary      List continue watching
+// @Description  Returns media the current user started but didn't finish, most recently played first, each with its media item.
+// @Tags         playback
+// @Produce      json
+// @Security     BearerAuth
+// @Param        count  query     int  false  "Maximum number of items, default 20"
+// @Success      200    {array}   database.PlaybackState
+// @Failure      400    {object}  handlers.ErrorResponse
+// @Failure      401    {object}  handlers.ErrorResponse
+// @Failure      500    {object}  handlers.ErrorResponse
+// @Router       /media/continue [get]
+func (h *Handler) ContinueWatching(w http.ResponseWriter, r *http.Request) {
+	count := defaultContinueCount
+	if value := r.URL.Query().Get("count"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 {
+			writeError(w, http.StatusBadRequest, "invalid count parameter")
+			return
+		}
+		count = parsed
+	}
+
+	states, err := h.DB.ContinueWatching(CurrentUser(r), count)
+	if err != nil {
+		h.Logger.Error("failed to list continue watching", zap.Error(err))
+		writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+
+	onDemand := h.streamOnDemand()
+	for _, state := range states {
+		if state.Media != nil {
+			state.Media.ResolveStreamMode(onDemand)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(states); err != nil {
+		h.Logger.Error("failed to encode response", zap.Error(err))
+	}
+}
@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"media_server/internal/share"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type ShareRequest struct {
+	// Lifetime of the link in seconds, default one day, at most 30 days.
+	ExpiresIn int64 `json:"expires_in" example:"86400"`
+	// How many times the stream may be started; 0 means no limit.
+	MaxUses int `json:"max_uses" example:"3"`
+}
+
+// RequireAuthOrShare is RequireAuth followed by RequireScope(scope) for
+// routes that can also be opened with a share link. Share links are checked
+// without touching the database. When countUses is set, requests that start
+// playing from the beginning count against the link's max uses; seeks and
+// range requests into the file don't.
+func (h *Handler) RequireAuthOrShare(scope string, countUses bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		authenticated := h.RequireAuth(h.RequireScope(scope)(next))
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			query := r.URL.Query()
+			if !query.Has("share") {
+				authenticated.ServeHTTP(w, r)
+				return
+			}
+
+			mediaID := chi.URLParam(r, "id")
+			err := h.Shares.Validate(query, mediaID, countUses && startsPlayback(r))
+			switch {
+			case err == nil:
+				next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), shareKey, mediaID)))
+			case errors.Is(err, share.ErrInvalid):
+				writeError(w, http.StatusForbidden, err.Error())
+			default:
+				writeError(w, http.StatusGone, err.Error())
+			}
+		})
+	}
+}
+
+// startsPlayback reports whether r requests a stream from its beginning.
+func startsPlayback(r *http.Request) bool {
+	if start := r.URL.Query().Get("start"); start != "" && start != "0" {
+		return false
+	}
+	rangeHeader := r.Header.Get("Range")
+	return rangeHeader == "" || strings.HasPrefix(rangeHeader, "bytes=0-")
+}
+
+// CreateShare godoc
+// @Summary      Create a share link
+// @Description  Creates signed links to stream a media item and fetch its thumbnail without an account.
+// @Description  Starting the stream from the beginning counts as a use; max_uses 0 means no limit. Not available to guests.
+// @Tags         shares
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id    path      string                 true   "Media Item ID"
+// @Param        body  body      handlers.ShareRequest  false  "Expiry and use limit"
+// @Success      201   {object}  database.ShareLink
+// @Failure      400   {object}  handlers.ErrorResponse
+// @Failure      401   {object}  handlers.ErrorResponse
+// @Failure      403   {object}  handlers.ErrorResponse
+// @Failure      404   {object}  handlers.ErrorResponse
+// @Failure      500   {object}  handlers.ErrorResponse
+// @Router       /media/{id}/share [post]
+func (h *Handler) CreateShare(w http.ResponseWriter, r *http.Request) {
+	var req ShareRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+	}
+	ttl := share.DefaultTTL
+	if req.ExpiresIn != 0 {
+		ttl = time.Duration(req.ExpiresIn) * time.Second
+	}
+	if ttl <= 0 || ttl > share.MaxTTL {
+		writeError(w, http.StatusBadRequest, "expires_in must be between 1 second and 30 days")
+		return
+	}
+	if req.MaxUses < 0 {
+		writeError(w, http.StatusBadRequest, "max_uses must not be negative")
+		return
+	}
+
+	mediaItem, err := h.visibleMediaItem(r, chi.URLParam(r, "id"))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			writeError(w, http.StatusNotFound, "media item not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+
+	link, query, err := h.Shares.Create(mediaItem.ID, CurrentUser(r).ID, ttl, req.MaxUses)
+	if err != nil {
+		h.Logger.Error("failed to create share link", zap.Error(err))
+		writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+	base := baseURL(r) + "/media/" + mediaItem.ID
+	link.StreamURL = base + "/stream?" + query.Encode()
+	link.ThumbnailURL = base + "/thumbnail?" + query.Encode()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(link); err != nil {
+		h.Logger.Error("failed to encode response", zap.Error(err))
+	}
+}
+
+// baseURL returns the scheme and host r was sent to.
+func baseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+// ListShares godoc
+// @Summary      List share links
+// @Description  Returns the share links created by the current user, or every link for admins, newest first. URLs aren't included.
+// @Tags         shares
+// @Produce      json
+// @Security     BearerAuth
+// @Success      200  {array}   database.ShareLink
+// @Failure      401  {object}  handlers.ErrorResponse
+// @Failure      403  {object}  handlers.ErrorResponse
+// @Failure      500  {object}  handlers.ErrorResponse
+// @Router       /shares [get]
+func (h *Handler) ListShares(w http.ResponseWriter, r *http.Request) {
+	user := CurrentUser(r)
+	owner := user.ID
+	if user.IsAdmin() {
+		owner = 0
+	}
+
+	links, err := h.DB.GetShareLinks(owner)
+	if err != nil {
+		h.Logger.Error("failed to list share links", zap.Error(err))
+		writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+	for i := range links {
+		if uses, ok := h.Shares.Uses(links[i].ID); ok {
+			links[i].Uses = uses
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(links); err != nil {
+		h.Logger.Error("failed to encode response", zap.Error(err))
+	}
+}
+
+// RevokeShare godoc
+// @Summary      Revoke a share link
+// @Description  Stops a share link from working. Users can revoke their own links, admins any link.
+// @Tags         shares
+// @Security     BearerAuth
+// @Param        id   path  string  true  "Share link ID"
+// @Success      204
+// @Failure      401  {object}  handlers.ErrorResponse
+// @Failure      403  {object}  handlers.ErrorResponse
+// @Failure      404  {object}  handlers.ErrorResponse
+// @Failure      500  {object}  handlers.ErrorResponse
+// @Router       /shares/{id} [delete]
+func (h *Handler) RevokeShare(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	user := CurrentUser(r)
+
+	link, err := h.DB.GetShareLink(id)
+	if err == nil && !user.IsAdmin() && link.UserID != user.ID {
+		err = gorm.ErrRecordNotFound
+	}
+	if err == nil {
+		err = h.Shares.Revoke(id)
+	}
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			writeError(w, http.StatusNotFound, "share link not found")
+			return
+		}
+		h.Logger.Error("failed to revoke share link", zap.Error(err))
+		writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
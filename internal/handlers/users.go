@@ -0,0 +1,248 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	database "media_server/internal/db"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type CreateUserRequest struct {
+	Username string `json:"username" example:"alice"`
+	Password string `json:"password" example:"correct horse battery staple"`
+	// One of admin, user or guest; defaults to user.
+	Role string `json:"role" example:"user"`
+	// Media directories the user may see; ignored for admins.
+	Libraries []string `json:"libraries"`
+}
+
+type UpdateUserRequest struct {
+	Role      string   `json:"role" example:"guest"`
+	Libraries []string `json:"libraries"`
+}
+
+// RequireRole rejects requests from users that have none of roles. It must
+// run after RequireAuth.
+func (h *Handler) RequireRole(roles ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			role := CurrentUser(r).Role
+			for _, allowed := range roles {
+				if role == allowed {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+			writeError(w, http.StatusForbidden, "your role doesn't allow this")
+		})
+	}
+}
+
+// validateAccess checks a role and library list for an account and returns
+// the libraries to store, which are empty for admins.
+func (h *Handler) validateAccess(role string, libraries []string) ([]string, error) {
+	if !database.ValidRole(role) {
+		return nil, fmt.Errorf("invalid role %q, must be admin, user or guest", role)
+	}
+	if role == database.RoleAdmin {
+		return []string{}, nil
+	}
+
+	cfg := h.Config.Get()
+	cleaned := make([]string, 0, len(libraries))
+	for _, library := range libraries {
+		dir := filepath.Clean(library)
+		if cfg.RootFor(dir) != dir {
+			return nil, fmt.Errorf("invalid library %q, must be one of the configured media directories", library)
+		}
+		if !contains(cleaned, dir) {
+			cleaned = append(cleaned, dir)
+		}
+	}
+	return cleaned, nil
+}
+
+// ListUsers godoc
+// @Summary      List users
+// @Description  Admins only.
+// @Tags         users
+// @Produce      json
+// @Security     BearerAuth
+// @Success      200  {array}   database.User
+// @Failure      401  {object}  handlers.ErrorResponse
+// @Failure      403  {object}  handlers.ErrorResponse
+// @Failure      500  {object}  handlers.ErrorResponse
+// @Router       /users [get]
+func (h *Handler) ListUsers(w http.ResponseWriter, r *http.Request) {
+	users, err := h.DB.GetUsers()
+	if err != nil {
+		h.Logger.Error("failed to list users", zap.Error(err))
+		writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(users); err != nil {
+		h.Logger.Error("failed to encode response", zap.Error(err))
+	}
+}
+
+// CreateUser godoc
+// @Summary      Create user
+// @Description  Admins only. Non-admin users only see the media directories listed in libraries.
+// @Tags         users
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        body  body      handlers.CreateUserRequest  true  "The new account"
+// @Success      201   {object}  database.User
+// @Failure      400   {object}  handlers.ErrorResponse
+// @Failure      401   {object}  handlers.ErrorResponse
+// @Failure      403   {object}  handlers.ErrorResponse
+// @Failure      409   {object}  handlers.ErrorResponse
+// @Failure      500   {object}  handlers.ErrorResponse
+// @Router       /users [post]
+func (h *Handler) CreateUser(w http.ResponseWriter, r *http.Request) {
+	var req CreateUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if strings.TrimSpace(req.Username) == "" {
+		writeError(w, http.StatusBadRequest, "username is required")
+		return
+	}
+	if len(req.Password) < minPasswordLength {
+		writeError(w, http.StatusBadRequest, "password must be at least "+strconv.Itoa(minPasswordLength)+" characters")
+		return
+	}
+	if req.Role == "" {
+		req.Role = database.RoleUser
+	}
+	libraries, err := h.validateAccess(req.Role, req.Libraries)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	user, err := h.DB.CreateUser(req.Username, req.Password, req.Role, libraries)
+	if err != nil {
+		if errors.Is(err, database.ErrUserExists) {
+			writeError(w, http.StatusConflict, err.Error())
+			return
+		}
+		h.Logger.Error("failed to create user", zap.Error(err))
+		writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(user); err != nil {
+		h.Logger.Error("failed to encode response", zap.Error(err))
+	}
+}
+
+// UpdateUser godoc
+// @Summary      Change a user's role and libraries
+// @Description  Admins only. The last admin can't be demoted.
+// @Tags         users
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id    path      int                         true  "User ID"
+// @Param        body  body      handlers.UpdateUserRequest  true  "New role and libraries"
+// @Success      200   {object}  database.User
+// @Failure      400   {object}  handlers.ErrorResponse
+// @Failure      401   {object}  handlers.ErrorResponse
+// @Failure      403   {object}  handlers.ErrorResponse
+// @Failure      404   {object}  handlers.ErrorResponse
+// @Failure      409   {object}  handlers.ErrorResponse
+// @Failure      500   {object}  handlers.ErrorResponse
+// @Router       /users/{id} [put]
+func (h *Handler) UpdateUser(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid user id")
+		return
+	}
+
+	var req UpdateUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	libraries, err := h.validateAccess(req.Role, req.Libraries)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	user, err := h.DB.UpdateUser(uint(id), req.Role, libraries)
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			writeError(w, http.StatusNotFound, "user not found")
+		case errors.Is(err, database.ErrLastAdmin):
+			writeError(w, http.StatusConflict, err.Error())
+		default:
+			h.Logger.Error("failed to update user", zap.Error(err))
+			writeError(w, http.StatusInternalServerError, "internal server error")
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(user); err != nil {
+		h.Logger.Error("failed to encode response", zap.Error(err))
+	}
+}
+
+// DeleteUser godoc
+// @Summary      Delete user
+// @Description  Admins only. Deletes an account with its sessions, API keys and watch progress, and revokes its share links. Users can't delete themselves.
+// @Tags         users
+// @Security     BearerAuth
+// @Param        id   path  int  true  "User ID"
+// @Success      204
+// @Failure      400  {object}  handlers.ErrorResponse
+// @Failure      401  {object}  handlers.ErrorResponse
+// @Failure      403  {object}  handlers.ErrorResponse
+// @Failure      404  {object}  handlers.ErrorResponse
+// @Failure      409  {object}  handlers.ErrorResponse
+// @Failure      500  {object}  handlers.ErrorResponse
+// @Router       /users/{id} [delete]
+func (h *Handler) DeleteUser(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid user id")
+		return
+	}
+	if uint(id) == CurrentUser(r).ID {
+		writeError(w, http.StatusBadRequest, "you can't delete your own account")
+		return
+	}
+
+	if err := h.DB.DeleteUser(uint(id)); err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			writeError(w, http.StatusNotFound, "user not found")
+		case errors.Is(err, database.ErrLastAdmin):
+			writeError(w, http.StatusConflict, err.Error())
+		default:
+			h.Logger.Error("failed to delete user", zap.Error(err))
+			writeError(w, http.StatusInternalServerError, "internal server error")
+		}
+		return
+	}
+	h.Shares.RevokeUser(uint(id))
+	w.WriteHeader(http.StatusNoContent)
+}
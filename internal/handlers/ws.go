@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"encoding/json"
+	"media_server/internal/hub"
+)
+
+const (
+	// WSProtocolVersion is the newest websocket protocol the server speaks.
+	// Version 1 is the original protocol with plain string errors; version
+	// 2 adds request ids and structured errors.
+	WSProtocolVersion = 2
+	// MinWSProtocolVersion is the oldest version a client may ask for.
+	MinWSProtocolVersion = 1
+)
+
+// Error codes sent in WSError.
+const (
+	WSErrInvalidPayload     = "invalid_payload"
+	WSErrUnknownEvent       = "unknown_event"
+	WSErrForbidden          = "forbidden"
+	WSErrUnsupportedVersion = "unsupported_version"
+	WSErrConfig             = "config_error"
+	WSErrFolderExists       = "folder_exists"
+	WSErrFolderNotFound     = "folder_not_found"
+	WSErrInvalidFolder      = "invalid_folder"
+	WSErrBrowseFailed       = "browse_failed"
+)
+
+// WSError is the data of an error event for clients using protocol version
+// 2, or sending request ids. Details depends on the code; for
+// invalid_folder it is a media.FolderError.
+type WSError struct {
+	Code    string      `json:"code" example:"folder_not_found"`
+	Message string      `json:"message" example:"folder not found"`
+	Details interface{} `json:"details,omitempty"`
+}
+
+// WSHello is exchanged in the hello handshake. Clients send the version
+// they want; the server answers with the version it will use and the range
+// it supports.
+type WSHello struct {
+	Version    int `json:"version"`
+	MinVersion int `json:"min_version,omitempty"`
+	MaxVersion int `json:"max_version,omitempty"`
+}
+
+// wsReply answers one websocket request. Replies carry the request's id, and
+// errors are structured unless the client speaks the original protocol and
+// sent no id.
+type wsReply struct {
+	client     *hub.Client
+	id         string
+	structured bool
+}
+
+func (r wsReply) Send(event string, data interface{}) {
+	r.client.Reply(r.id, event, data)
+}
+
+func (r wsReply) Error(code string, message string) {
+	r.Fail(WSError{Code: code, Message: message})
+}
+
+func (r wsReply) Fail(e WSError) {
+	if r.structured {
+		r.Send("error", e)
+		return
+	}
+	r.Send("error", e.Message)
+}
+
+// negotiate handles a hello request and returns the protocol version to use
+// from now on, or current if the request was rejected.
+func negotiate(data json.RawMessage, current int, reply wsReply) int {
+	var hello WSHello
+	if err := json.Unmarshal(data, &hello); err != nil || hello.Version == 0 {
+		reply.Error(WSErrInvalidPayload, "invalid payload")
+		return current
+	}
+	if hello.Version < MinWSProtocolVersion {
+		reply.Error(WSErrUnsupportedVersion, "unsupported protocol version")
+		return current
+	}
+
+	version := min(hello.Version, WSProtocolVersion)
+	reply.structured = version >= 2 || reply.id != ""
+	reply.Send("hello", WSHello{Version: version, MinVersion: MinWSProtocolVersion, MaxVersion: WSProtocolVersion})
+	return version
+}
@@ -0,0 +1,226 @@
+package hub
+
+import (
+	"encoding/json"
+	database "media_server/internal/db"
+	"media_server/internal/logger"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// sendBuffer is how many messages may queue up for a client before it
+	// is considered too slow and disconnected.
+	sendBuffer = 64
+
+	writeWait  = 10 * time.Second
+	pongWait   = 60 * time.Second
+	pingPeriod = pongWait * 9 / 10
+)
+
+// Message is the envelope of every event sent to clients. ID echoes the id
+// of the request being answered and is empty for broadcasts.
+type Message struct {
+	ID    string      `json:"id,omitempty"`
+	Event string      `json:"event"`
+	Data  interface{} `json:"data"`
+}
+
+// ConfigRejectedPayload is the data of a config_rejected event.
+type ConfigRejectedPayload struct {
+	Error string `json:"error"`
+}
+
+// MediaRemovedPayload is the data of a media_removed event.
+type MediaRemovedPayload struct {
+	IDs []string `json:"ids"`
+}
+
+// Hub tracks every connected websocket client and broadcasts library and
+// config changes to the ones allowed to see them. It implements
+// database.Listener.
+type Hub struct {
+	mu      sync.RWMutex
+	clients map[*Client]struct{}
+}
+
+// Client is a single websocket connection. Messages are queued and written
+// by a dedicated goroutine, so sending never blocks.
+type Client struct {
+	hub  *Hub
+	conn *websocket.Conn
+	user database.User
+	send chan []byte
+
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+func New() *Hub {
+	return &Hub{clients: make(map[*Client]struct{})}
+}
+
+// Register adds conn, authenticated as user, to the hub and starts writing
+// to it. The caller keeps reading from conn and must Close the client when
+// it's done.
+func (h *Hub) Register(conn *websocket.Conn, user database.User) *Client {
+	c := &Client{
+		hub:  h,
+		conn: conn,
+		user: user,
+		send: make(chan []byte, sendBuffer),
+		done: make(chan struct{}),
+	}
+	conn.SetReadDeadline(time.Now().Add(pongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	h.mu.Lock()
+	h.clients[c] = struct{}{}
+	h.mu.Unlock()
+
+	go c.writeLoop()
+	return c
+}
+
+// Close disconnects every client.
+func (h *Hub) Close() {
+	for _, c := range h.snapshot() {
+		c.Close()
+	}
+}
+
+// Broadcast sends an event to every client whose user passes filter.
+func (h *Hub) Broadcast(event string, data interface{}, filter func(user database.User) bool) {
+	msg, err := json.Marshal(Message{Event: event, Data: data})
+	if err != nil {
+		logger.Log().Sugar().Errorf("failed to encode %s event: %v", event, err)
+		return
+	}
+	for _, c := range h.snapshot() {
+		if filter == nil || filter(c.user) {
+			c.enqueue(msg)
+		}
+	}
+}
+
+// ConfigUpdated tells admins about a new config.
+func (h *Hub) ConfigUpdated(config interface{}) {
+	h.Broadcast("config_updated", config, isAdmin)
+}
+
+// ConfigRejected tells admins that an edit of the config file was rejected.
+func (h *Hub) ConfigRejected(err error) {
+	h.Broadcast("config_rejected", ConfigRejectedPayload{Error: err.Error()}, isAdmin)
+}
+
+// MediaAdded tells everyone who can see it about a new media item.
+func (h *Hub) MediaAdded(item database.MediaItem) {
+	h.Broadcast("media_added", item, func(user database.User) bool {
+		return canSee(user, item.Root)
+	})
+}
+
+// MediaRemoved tells every client which of the removed items it could see.
+func (h *Hub) MediaRemoved(items []database.MediaItem) {
+	for _, c := range h.snapshot() {
+		ids := make([]string, 0, len(items))
+		for _, item := range items {
+			if canSee(c.user, item.Root) {
+				ids = append(ids, item.ID)
+			}
+		}
+		if len(ids) > 0 {
+			c.Send("media_removed", MediaRemovedPayload{IDs: ids})
+		}
+	}
+}
+
+// SyncProgress tells admins how a library scan is getting on.
+func (h *Hub) SyncProgress(progress database.SyncProgress) {
+	h.Broadcast("scan_progress", progress, isAdmin)
+}
+
+func (h *Hub) snapshot() []*Client {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	clients := make([]*Client, 0, len(h.clients))
+	for c := range h.clients {
+		clients = append(clients, c)
+	}
+	return clients
+}
+
+func isAdmin(user database.User) bool {
+	return user.IsAdmin() && user.HasScope(database.ScopeAdmin)
+}
+
+func canSee(user database.User, root string) bool {
+	return user.HasScope(database.ScopeRead) && user.Access().Allows(root)
+}
+
+// Send queues an event for this client only.
+func (c *Client) Send(event string, data interface{}) {
+	c.Reply("", event, data)
+}
+
+// Reply queues an event answering the client's request id.
+func (c *Client) Reply(id string, event string, data interface{}) {
+	msg, err := json.Marshal(Message{ID: id, Event: event, Data: data})
+	if err != nil {
+		logger.Log().Sugar().Errorf("failed to encode %s event: %v", event, err)
+		return
+	}
+	c.enqueue(msg)
+}
+
+// enqueue queues msg, disconnecting the client if its buffer is full rather
+// than letting it hold up everyone else.
+func (c *Client) enqueue(msg []byte) {
+	select {
+	case <-c.done:
+	case c.send <- msg:
+	default:
+		logger.Log().Sugar().Warnf("Disconnecting slow websocket client %s", c.conn.RemoteAddr())
+		c.Close()
+	}
+}
+
+// Close removes the client from the hub and closes its connection.
+func (c *Client) Close() {
+	c.closeOnce.Do(func() {
+		c.hub.mu.Lock()
+		delete(c.hub.clients, c)
+		c.hub.mu.Unlock()
+		close(c.done)
+		c.conn.Close()
+	})
+}
+
+func (c *Client) writeLoop() {
+	ticker := time.NewTicker(pingPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case msg := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.conn.WriteMessage(websocket.TextMessage, msg); err != nil {
+				logger.Log().Sugar().Warnf("failed to write to websocket client %s: %v", c.conn.RemoteAddr(), err)
+				c.Close()
+				return
+			}
+		case <-ticker.C:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				c.Close()
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package library
+
+import (
+	database "media_server/internal/db"
+	"media_server/internal/logger"
+	"media_server/internal/media"
+	"media_server/internal/thumbnail"
+	"sync"
+)
+
+type jobKind int
+
+const (
+	// scanDir indexes a media directory that was added.
+	scanDir jobKind = iota
+	// purgeDir drops the media of a media directory that was removed.
+	purgeDir
+	// syncAll rescans every media directory, e.g. after the supported
+	// extensions changed.
+	syncAll
+)
+
+type job struct {
+	kind   jobKind
+	dir    string
+	config *media.Config
+}
+
+// Syncer brings the media table in line with config changes: added media
+// directories are scanned, removed ones purged, and everything is rescanned
+// when the supported extensions change. Work runs in the background, one
+// job at a time, in the order the changes were made. Progress reaches the
+// database listener as for any sync.
+type Syncer struct {
+	db           *database.DBObject
+	pregenerator *thumbnail.Pregenerator
+
+	mu     sync.Mutex
+	config *media.Config
+	queue  []job
+
+	wake chan struct{}
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+func NewSyncer(config *media.Config, db *database.DBObject, pregenerator *thumbnail.Pregenerator) *Syncer {
+	return &Syncer{
+		db:           db,
+		pregenerator: pregenerator,
+		config:       config,
+		wake:         make(chan struct{}, 1),
+		done:         make(chan struct{}),
+	}
+}
+
+// Start begins processing config changes in the background.
+func (s *Syncer) Start() {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for {
+			select {
+			case <-s.done:
+				return
+			case <-s.wake:
+				for {
+					next, ok := s.next()
+					if !ok {
+						break
+					}
+					s.run(next)
+				}
+			}
+		}
+	}()
+}
+
+// Close stops the syncer once the current job finishes. Queued jobs are
+// dropped; the next startup scan catches up with them.
+func (s *Syncer) Close() {
+	close(s.done)
+	s.wg.Wait()
+}
+
+// ConfigChanged queues the work config needs compared to the previous
+// config. Subscribe it to the config store.
+func (s *Syncer) ConfigChanged(config *media.Config, version uint64) {
+	s.mu.Lock()
+	diff := media.Diff(s.config, config)
+	s.config = config
+	if diff.ExtensionsChanged || diff.KindsChanged {
+		s.queue = append(s.queue, job{kind: syncAll, config: config})
+	} else {
+		for _, dir := range diff.AddedDirs {
+			s.queue = append(s.queue, job{kind: scanDir, dir: dir, config: config})
+		}
+		for _, dir := range diff.RemovedDirs {
+			s.queue = append(s.queue, job{kind: purgeDir, dir: dir, config: config})
+		}
+	}
+	s.mu.Unlock()
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *Syncer) next() (job, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.queue) == 0 {
+		return job{}, false
+	}
+	next := s.queue[0]
+	s.queue = s.queue[1:]
+	return next, true
+}
+
+func (s *Syncer) run(j job) {
+	switch j.kind {
+	case scanDir:
+		s.scan(j.config, j.dir)
+	case purgeDir:
+		s.purge(j.config, j.dir)
+	case syncAll:
+		s.syncAll(j.config)
+	}
+}
+
+// scan indexes dir after it was added to config.
+func (s *Syncer) scan(config *media.Config, dir string) {
+	files, err := config.ScanDir(dir)
+	if err != nil {
+		logger.Log().Sugar().Errorf("failed to scan %s: %v", dir, err)
+		return
+	}
+	report, err := s.db.SyncDirectory(dir, &files)
+	if err != nil {
+		logger.Log().Sugar().Errorf("failed to sync %s: %v", dir, err)
+		return
+	}
+	logger.Log().Sugar().Infof("Scanned %s: %d added, %d removed", dir, report.Added, report.Removed)
+	s.pregenerator.Trigger()
+}
+
+// purge drops the media of dir after it was removed from config. When
+// another media directory still contains it, its media is kept and moved to
+// that directory instead.
+func (s *Syncer) purge(config *media.Config, dir string) {
+	if config.RootFor(dir) != "" {
+		s.scan(config, dir)
+		return
+	}
+
+	removed, err := s.db.DeleteMediaInRoot(dir)
+	if err != nil {
+		logger.Log().Sugar().Errorf("failed to purge %s: %v", dir, err)
+		return
+	}
+	logger.Log().Sugar().Infof("Removed %s: %d media items", dir, removed)
+}
+
+// syncAll rescans every media directory of config.
+func (s *Syncer) syncAll(config *media.Config) {
+	files, err := config.ScanMediaDirs()
+	if err != nil {
+		logger.Log().Sugar().Errorf("failed to scan media: %v", err)
+		return
+	}
+	report, err := s.db.SyncDatabase(&files)
+	if err != nil {
+		logger.Log().Sugar().Errorf("failed to sync media: %v", err)
+		return
+	}
+	logger.Log().Sugar().Infof("Library rescanned: %d added, %d removed, %d unchanged", report.Added, report.Removed, report.Unchanged)
+	s.pregenerator.Trigger()
+}
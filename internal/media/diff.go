@@ -0,0 +1,116 @@
+package media
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// ConfigDiff lists what changed between two configs.
+type ConfigDiff struct {
+	AddedDirs         []string
+	RemovedDirs       []string
+	ExtensionsChanged bool
+	KindsChanged      bool
+	StreamModeChanged bool
+	ThumbnailsChanged bool
+	ServerChanged     bool
+}
+
+// Diff returns the changes from old to config. Media directories are
+// compared as clean paths.
+func Diff(old *Config, config *Config) ConfigDiff {
+	var diff ConfigDiff
+	for _, dir := range config.MediaDirs {
+		if !containsDir(old.MediaDirs, dir) {
+			diff.AddedDirs = append(diff.AddedDirs, dir)
+		}
+	}
+	for _, dir := range old.MediaDirs {
+		if !containsDir(config.MediaDirs, dir) {
+			diff.RemovedDirs = append(diff.RemovedDirs, dir)
+		}
+	}
+	diff.ExtensionsChanged = !slices.Equal(old.SupportedExtensions, config.SupportedExtensions)
+	diff.KindsChanged = !maps.Equal(old.MediaKinds, config.MediaKinds)
+	diff.StreamModeChanged = old.StreamOnDemand != config.StreamOnDemand
+	diff.ThumbnailsChanged = old.ThumbnailCacheDir != config.ThumbnailCacheDir || old.ThumbnailCacheSizeMB != config.ThumbnailCacheSizeMB
+	diff.ServerChanged = !old.sameServer(config)
+	return diff
+}
+
+// Equal reports whether config and other hold the same settings.
+func (config *Config) Equal(other *Config) bool {
+	return slices.Equal(config.MediaDirs, other.MediaDirs) &&
+		slices.Equal(config.SupportedExtensions, other.SupportedExtensions) &&
+		maps.Equal(config.MediaKinds, other.MediaKinds) &&
+		config.StreamOnDemand == other.StreamOnDemand &&
+		config.ThumbnailCacheDir == other.ThumbnailCacheDir &&
+		config.ThumbnailCacheSizeMB == other.ThumbnailCacheSizeMB &&
+		config.sameServer(other)
+}
+
+func (config *Config) sameServer(other *Config) bool {
+	return config.BindAddress == other.BindAddress &&
+		config.HTTPPort == other.HTTPPort &&
+		config.WSPort == other.WSPort &&
+		slices.Equal(config.CORSOrigins, other.CORSOrigins) &&
+		config.DBPath == other.DBPath &&
+		config.SwaggerURL == other.SwaggerURL
+}
+
+// Validate checks a config read from disk before it replaces previous.
+// Media directories new to it are checked like ValidateMediaDir checks an
+// added one, against all the others, and replaced by their absolute path
+// with symlinks resolved; the ones previous already had are accepted as they
+// are, even if they have gone missing. Every problem found is returned,
+// joined.
+func (config *Config) Validate(previous *Config) error {
+	var errs []error
+	for i, dir := range config.MediaDirs {
+		if containsDir(previous.MediaDirs, dir) {
+			continue
+		}
+		others := Config{MediaDirs: slices.Delete(slices.Clone(config.MediaDirs), i, i+1)}
+		resolved, err := others.ValidateMediaDir(dir)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		config.MediaDirs[i] = resolved
+	}
+	for _, ext := range config.SupportedExtensions {
+		if !strings.HasPrefix(ext, ".") || len(ext) < 2 {
+			errs = append(errs, fmt.Errorf("invalid extension %q, must start with a dot", ext))
+		}
+	}
+	for _, ext := range slices.Sorted(maps.Keys(config.MediaKinds)) {
+		kind := config.MediaKinds[ext]
+		if !strings.HasPrefix(ext, ".") || len(ext) < 2 {
+			errs = append(errs, fmt.Errorf("invalid extension %q in media_kinds, must start with a dot", ext))
+		}
+		if !IsKind(kind) {
+			errs = append(errs, fmt.Errorf("invalid kind %q for %s, must be one of %s", kind, ext, strings.Join(Kinds, ", ")))
+		}
+	}
+	if config.ThumbnailCacheSizeMB < 0 {
+		errs = append(errs, errors.New("thumbnail_cache_size_mb can't be negative"))
+	}
+	if config.HTTPPort < 0 || config.HTTPPort > 65535 {
+		errs = append(errs, fmt.Errorf("invalid http_port %d", config.HTTPPort))
+	}
+	if config.WSPort < 0 || config.WSPort > 65535 {
+		errs = append(errs, fmt.Errorf("invalid ws_port %d", config.WSPort))
+	}
+	return errors.Join(errs...)
+}
+
+func containsDir(dirs []string, dir string) bool {
+	dir = filepath.Clean(dir)
+	return slices.ContainsFunc(dirs, func(d string) bool {
+		return filepath.Clean(d) == dir
+	})
+}
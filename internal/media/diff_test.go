@@ -0,0 +1,162 @@
+package media
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	base := Config{
+		MediaDirs:           []string{"/films", "/music/"},
+		SupportedExtensions: []string{".mp4"},
+		MediaKinds:          map[string]string{".divx": KindVideo},
+		HTTPPort:            8000,
+	}
+
+	tests := []struct {
+		name   string
+		change func(c *Config)
+		want   ConfigDiff
+	}{
+		{"nothing", func(c *Config) {}, ConfigDiff{}},
+		{"same dirs, written differently", func(c *Config) {
+			c.MediaDirs = []string{"/music", "/films/"}
+		}, ConfigDiff{}},
+		{"dirs added and removed", func(c *Config) {
+			c.MediaDirs = []string{"/films", "/shows"}
+		}, ConfigDiff{AddedDirs: []string{"/shows"}, RemovedDirs: []string{"/music/"}}},
+		{"extensions", func(c *Config) {
+			c.SupportedExtensions = []string{".mp4", ".mkv"}
+		}, ConfigDiff{ExtensionsChanged: true}},
+		{"extensions unset", func(c *Config) {
+			c.SupportedExtensions = nil
+		}, ConfigDiff{ExtensionsChanged: true}},
+		{"kinds", func(c *Config) {
+			c.MediaKinds = map[string]string{".divx": KindAudio}
+		}, ConfigDiff{KindsChanged: true}},
+		{"stream mode", func(c *Config) {
+			c.StreamOnDemand = true
+		}, ConfigDiff{StreamModeChanged: true}},
+		{"thumbnails", func(c *Config) {
+			c.ThumbnailCacheSizeMB = 50
+		}, ConfigDiff{ThumbnailsChanged: true}},
+		{"server", func(c *Config) {
+			c.HTTPPort = 8080
+		}, ConfigDiff{ServerChanged: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := base.clone()
+			tt.change(config)
+
+			if got := Diff(&base, config); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Diff = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	root := t.TempDir()
+	mkdir := func(name string) string {
+		dir := filepath.Join(root, name)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		return dir
+	}
+	films := mkdir("films")
+	shows := mkdir("shows")
+	nested := mkdir("films/extras")
+	file := filepath.Join(root, "file.txt")
+	if err := os.WriteFile(file, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	missing := filepath.Join(root, "missing")
+	resolvedRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	previous := &Config{MediaDirs: []string{films, missing}}
+
+	tests := []struct {
+		name     string
+		config   Config
+		wantDirs []string
+		// wantReasons are the FolderError reasons expected, in order.
+		wantReasons []string
+		// wantErrs are substrings of the other errors expected, in order;
+		// media_kinds is checked in sorted order.
+		wantErrs []string
+	}{
+		{
+			name:     "unchanged dirs are kept even when missing",
+			config:   Config{MediaDirs: []string{films, missing}},
+			wantDirs: []string{films, missing},
+		},
+		{
+			name:     "new dir is resolved",
+			config:   Config{MediaDirs: []string{films, shows + "/"}},
+			wantDirs: []string{films, filepath.Join(resolvedRoot, "shows")},
+		},
+		{
+			name:        "new dirs are checked",
+			config:      Config{MediaDirs: []string{films, nested, file, filepath.Join(root, "gone"), ""}},
+			wantReasons: []string{ReasonNested, ReasonNotDirectory, ReasonNotFound, ReasonEmpty},
+		},
+		{
+			name: "extensions and kinds",
+			config: Config{
+				SupportedExtensions: []string{".mp4", "mkv", "."},
+				MediaKinds:          map[string]string{".divx": KindVideo, "xvid": KindVideo, ".mid": "music"},
+			},
+			wantErrs: []string{`"mkv"`, `"."`, `kind "music"`, `"xvid" in media_kinds`},
+		},
+		{
+			name:     "numbers",
+			config:   Config{ThumbnailCacheSizeMB: -1, HTTPPort: 70000, WSPort: -1},
+			wantErrs: []string{"thumbnail_cache_size_mb", "http_port 70000", "ws_port -1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := tt.config.clone()
+			err := config.Validate(previous)
+
+			var errs []error
+			if joined, ok := err.(interface{ Unwrap() []error }); ok {
+				errs = joined.Unwrap()
+			}
+			var reasons []string
+			var messages []string
+			for _, err := range errs {
+				var folderErr *FolderError
+				if errors.As(err, &folderErr) {
+					reasons = append(reasons, folderErr.Reason)
+				} else {
+					messages = append(messages, err.Error())
+				}
+			}
+			if !slices.Equal(reasons, tt.wantReasons) {
+				t.Errorf("folder errors = %v, want %v (error: %v)", reasons, tt.wantReasons, err)
+			}
+			if len(messages) != len(tt.wantErrs) {
+				t.Fatalf("errors = %q, want %d matching %q", messages, len(tt.wantErrs), tt.wantErrs)
+			}
+			for i, want := range tt.wantErrs {
+				if !strings.Contains(messages[i], want) {
+					t.Errorf("error %d = %q, want it to contain %q", i, messages[i], want)
+				}
+			}
+			if err == nil && tt.wantDirs != nil && !slices.Equal(config.MediaDirs, tt.wantDirs) {
+				t.Errorf("MediaDirs = %v, want %v", config.MediaDirs, tt.wantDirs)
+			}
+		})
+	}
+}
@@ -0,0 +1,179 @@
+package media
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Reasons a directory can't be added as a media directory.
+const (
+	ReasonEmpty        = "empty"
+	ReasonNotFound     = "not_found"
+	ReasonNotDirectory = "not_directory"
+	ReasonNotReadable  = "not_readable"
+	ReasonExists       = "already_added"
+	ReasonNested       = "nested"
+	ReasonContains     = "contains"
+)
+
+// FolderError explains why a directory was rejected as a media directory.
+// Conflict is the configured media directory it overlaps with, if any.
+type FolderError struct {
+	Path     string `json:"path"`
+	Reason   string `json:"reason" example:"nested"`
+	Conflict string `json:"conflict,omitempty"`
+}
+
+func (e *FolderError) Error() string {
+	switch e.Reason {
+	case ReasonEmpty:
+		return "folder is required"
+	case ReasonNotFound:
+		return fmt.Sprintf("%s does not exist", e.Path)
+	case ReasonNotDirectory:
+		return fmt.Sprintf("%s is not a directory", e.Path)
+	case ReasonNotReadable:
+		return fmt.Sprintf("%s is not readable", e.Path)
+	case ReasonExists:
+		return "folder already exists"
+	case ReasonNested:
+		return fmt.Sprintf("%s is inside the media directory %s", e.Path, e.Conflict)
+	case ReasonContains:
+		return fmt.Sprintf("%s contains the media directory %s", e.Path, e.Conflict)
+	default:
+		return fmt.Sprintf("%s can't be used: %s", e.Path, e.Reason)
+	}
+}
+
+// ValidateMediaDir checks that dir can be added as a media directory: it
+// must be a readable directory that doesn't overlap any configured media
+// directory. It returns the absolute path of dir with symlinks resolved,
+// which is what should be stored, or a *FolderError.
+func (config *Config) ValidateMediaDir(dir string) (string, error) {
+	if strings.TrimSpace(dir) == "" {
+		return "", &FolderError{Path: dir, Reason: ReasonEmpty}
+	}
+
+	resolved, err := resolveDir(dir)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return "", &FolderError{Path: dir, Reason: ReasonNotFound}
+		}
+		return "", &FolderError{Path: dir, Reason: ReasonNotReadable}
+	}
+	if reason := dirProblem(resolved); reason != "" {
+		return "", &FolderError{Path: dir, Reason: reason}
+	}
+
+	for _, existing := range config.MediaDirs {
+		other, err := resolveDir(existing)
+		if err != nil {
+			// A configured directory that has gone missing can't overlap.
+			other = filepath.Clean(existing)
+		}
+		switch {
+		case resolved == other:
+			return "", &FolderError{Path: dir, Reason: ReasonExists, Conflict: existing}
+		case IsWithin(resolved, other):
+			return "", &FolderError{Path: dir, Reason: ReasonNested, Conflict: existing}
+		case IsWithin(other, resolved):
+			return "", &FolderError{Path: dir, Reason: ReasonContains, Conflict: existing}
+		}
+	}
+	return resolved, nil
+}
+
+// resolveDir returns the absolute path of dir with symlinks resolved.
+func resolveDir(dir string) (string, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	return filepath.EvalSymlinks(abs)
+}
+
+// dirProblem returns the FolderError reason why dir isn't a directory whose
+// entries can be listed, or an empty string if it is.
+func dirProblem(dir string) string {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return ReasonNotReadable
+	}
+	if !info.IsDir() {
+		return ReasonNotDirectory
+	}
+	f, err := os.Open(dir)
+	if err != nil {
+		return ReasonNotReadable
+	}
+	defer f.Close()
+	if _, err := f.Readdirnames(1); err != nil && err != io.EOF {
+		return ReasonNotReadable
+	}
+	return ""
+}
+
+// DirEntry is a subdirectory in a Listing.
+type DirEntry struct {
+	Name string `json:"name" example:"films"`
+	Path string `json:"path" example:"/srv/media/films"`
+	// InLibrary is set for configured media directories and the
+	// directories inside them.
+	InLibrary bool `json:"in_library"`
+}
+
+// Listing is the result of Browse.
+type Listing struct {
+	Path string `json:"path" example:"/srv/media"`
+	// Parent is empty at the filesystem root.
+	Parent  string     `json:"parent,omitempty" example:"/srv"`
+	Entries []DirEntry `json:"entries"`
+}
+
+// Browse lists the subdirectories of dir, sorted by name, so a media
+// directory can be picked. Hidden directories are left out. An empty dir
+// lists the filesystem root.
+func (config *Config) Browse(dir string) (Listing, error) {
+	if dir == "" {
+		dir = string(filepath.Separator)
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return Listing{}, err
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return Listing{}, err
+	}
+
+	listing := Listing{Path: dir, Entries: make([]DirEntry, 0, len(entries))}
+	if parent := filepath.Dir(dir); parent != dir {
+		listing.Parent = parent
+	}
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		isDir := entry.IsDir()
+		if entry.Type()&fs.ModeSymlink != 0 {
+			info, err := os.Stat(path)
+			isDir = err == nil && info.IsDir()
+		}
+		if !isDir {
+			continue
+		}
+		listing.Entries = append(listing.Entries, DirEntry{
+			Name:      entry.Name(),
+			Path:      path,
+			InLibrary: config.RootFor(path) != "",
+		})
+	}
+	return listing, nil
+}
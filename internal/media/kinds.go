@@ -0,0 +1,150 @@
+package media
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Kinds of media.
+const (
+	KindVideo    = "video"
+	KindAudio    = "audio"
+	KindImage    = "image"
+	KindSubtitle = "subtitle"
+)
+
+// Kinds lists the kinds of media, in the order they are documented.
+var Kinds = []string{KindVideo, KindAudio, KindImage, KindSubtitle}
+
+// defaultKinds is the built-in registry of extensions and their kinds. The
+// media_kinds config setting overrides or extends it.
+var defaultKinds = map[string]string{
+	".3gp": KindVideo, ".avi": KindVideo, ".flv": KindVideo, ".m2ts": KindVideo,
+	".m4v": KindVideo, ".mkv": KindVideo, ".mov": KindVideo, ".mp4": KindVideo,
+	".mpeg": KindVideo, ".mpg": KindVideo, ".mts": KindVideo, ".ogv": KindVideo,
+	".ts": KindVideo, ".webm": KindVideo, ".wmv": KindVideo,
+
+	".aac": KindAudio, ".aiff": KindAudio, ".ape": KindAudio,
+	".flac": KindAudio, ".m4a": KindAudio, ".mka": KindAudio, ".mp3": KindAudio,
+	".oga": KindAudio, ".ogg": KindAudio, ".opus": KindAudio, ".wav": KindAudio,
+	".wma": KindAudio,
+
+	".avif": KindImage, ".bmp": KindImage, ".gif": KindImage, ".heic": KindImage,
+	".jpeg": KindImage, ".jpg": KindImage, ".png": KindImage, ".tif": KindImage,
+	".tiff": KindImage, ".webp": KindImage,
+
+	".ass": KindSubtitle, ".srt": KindSubtitle, ".ssa": KindSubtitle,
+	".sub": KindSubtitle, ".vtt": KindSubtitle,
+}
+
+// mimeKinds maps sniffed MIME types, or their top-level type followed by a
+// slash, to kinds. It is used for files whose extension isn't registered.
+var mimeKinds = map[string]string{
+	"video/":          KindVideo,
+	"audio/":          KindAudio,
+	"image/":          KindImage,
+	"application/ogg": KindAudio,
+}
+
+// scannedByDefault are the kinds whose extensions are scanned when the
+// config doesn't list supported_extensions.
+var scannedByDefault = []string{KindVideo, KindAudio}
+
+// IsKind reports whether kind is one of Kinds.
+func IsKind(kind string) bool {
+	return slices.Contains(Kinds, kind)
+}
+
+// registry is the media kinds registry of a config with its overrides
+// applied, and the extensions it scans for.
+type registry struct {
+	kinds map[string]string
+	exts  []string
+}
+
+// index builds the registry of config once, so scanning doesn't rebuild it
+// for every file. It must be called before config is shared.
+func (config *Config) index() {
+	config.registry = config.buildRegistry()
+}
+
+func (config *Config) getRegistry() *registry {
+	if config.registry != nil {
+		return config.registry
+	}
+	return config.buildRegistry()
+}
+
+func (config *Config) buildRegistry() *registry {
+	r := &registry{kinds: defaultKinds}
+	if len(config.MediaKinds) > 0 {
+		r.kinds = make(map[string]string, len(defaultKinds)+len(config.MediaKinds))
+		for ext, kind := range defaultKinds {
+			r.kinds[ext] = kind
+		}
+		for ext, kind := range config.MediaKinds {
+			r.kinds[strings.ToLower(ext)] = kind
+		}
+	}
+
+	if len(config.SupportedExtensions) > 0 {
+		for _, ext := range config.SupportedExtensions {
+			r.exts = append(r.exts, strings.ToLower(ext))
+		}
+		return r
+	}
+	for ext, kind := range r.kinds {
+		if slices.Contains(scannedByDefault, kind) {
+			r.exts = append(r.exts, ext)
+		}
+	}
+	slices.Sort(r.exts)
+	return r
+}
+
+// Extensions returns the extensions to scan for, in lower case. Without
+// configured supported_extensions these are the video and audio extensions
+// of the registry.
+func (config *Config) Extensions() []string {
+	return slices.Clone(config.getRegistry().exts)
+}
+
+// KindOf returns the kind of the file at path: the one registered for its
+// extension or, for unregistered extensions, the one of its sniffed MIME
+// type. It returns an empty string if neither is known.
+func (config *Config) KindOf(path string) string {
+	if kind, ok := config.getRegistry().kinds[strings.ToLower(filepath.Ext(path))]; ok {
+		return kind
+	}
+	return sniffKind(path)
+}
+
+// KindOfExt returns the kind registered for ext in the built-in registry,
+// without the config's overrides.
+func KindOfExt(ext string) string {
+	return defaultKinds[strings.ToLower(ext)]
+}
+
+func sniffKind(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return ""
+	}
+	mimeType, _, _ := strings.Cut(http.DetectContentType(head[:n]), ";")
+	if kind, ok := mimeKinds[mimeType]; ok {
+		return kind
+	}
+	topLevel, _, _ := strings.Cut(mimeType, "/")
+	return mimeKinds[topLevel+"/"]
+}
@@ -2,19 +2,42 @@ package media
 
 import (
 	"crypto/sha1"
-	"encoding/json"
-	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
-	"sync"
+)
+
+const (
+	DefaultThumbnailCacheDir    = "thumbnails"
+	DefaultThumbnailCacheSizeMB = 200
 )
 
 type Config struct {
-	MediaDirs           []string `json:"media_dirs"`
-	SupportedExtensions []string `json:"supported_extensions"`
+	MediaDirs []string `json:"media_dirs"`
+	// SupportedExtensions limits scanning to these extensions; when empty,
+	// and then left out of the file, the default extensions are scanned.
+	SupportedExtensions []string `json:"supported_extensions,omitempty"`
 	StreamOnDemand      bool     `json:"on_demand"`
+	// MediaKinds maps extensions to one of Kinds, overriding or extending
+	// the built-in registry.
+	MediaKinds map[string]string `json:"media_kinds,omitempty"`
+
+	ThumbnailCacheDir    string `json:"thumbnail_cache_dir,omitempty"`
+	ThumbnailCacheSizeMB int    `json:"thumbnail_cache_size_mb,omitempty"`
+
+	// Server settings, only read at startup. Flags and environment
+	// variables override them, see ServerSettings.
+
+	BindAddress string   `json:"bind_address,omitempty"`
+	HTTPPort    int      `json:"http_port,omitempty"`
+	WSPort      int      `json:"ws_port,omitempty"`
+	CORSOrigins []string `json:"cors_origins,omitempty"`
+	DBPath      string   `json:"db_path,omitempty"`
+	SwaggerURL  string   `json:"swagger_url,omitempty"`
+
+	// registry is built by index, see Extensions and KindOf.
+	registry *registry
 }
 
 type MediaFile struct {
@@ -22,134 +45,123 @@ type MediaFile struct {
 	Name string `json:"name"`
 	Path string `json:"path"`
 	Ext  string `json:"ext"`
-}
-
-var configLock sync.Mutex
-var configPath string
-
-func SetConfigPath(path string) {
-	configPath = path
-}
-func GetConfigPath() (path string) {
-	return configPath
-}
-
-func LoadConfig() (*Config, error) {
-	if configPath == "" {
-		return nil, errors.New("config path not set")
-	}
-	data, err := os.ReadFile(configPath)
-	if err != nil {
-		return nil, err
-	}
-	var config Config
-
-	if erro := json.Unmarshal(data, &config); erro != nil {
-		return nil, erro
-	}
-	return &config, nil
+	// Root is the configured media directory the file was found under.
+	Root string `json:"root"`
+	// Type is the kind of media, see KindOf.
+	Type string `json:"type"`
 }
 
 func (config *Config) ScanMediaDirs() ([]MediaFile, error) {
 	var files []MediaFile
 	for _, dir := range config.MediaDirs {
-		err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
-			if err != nil || info.IsDir() {
-				return nil
-			}
-
-			ext := strings.ToLower(filepath.Ext(path))
-			if contains(config.SupportedExtensions, ext) {
-				id := hashFilePath(path)
-				files = append(files, MediaFile{
-					ID:   id,
-					Name: info.Name(),
-					Path: path,
-					Ext:  ext,
-				})
-
-			}
-			return nil
-		})
+		dirFiles, err := config.ScanDir(dir)
 		if err != nil {
 			return nil, err
 		}
+		files = append(files, dirFiles...)
 	}
 	return files, nil
 }
 
-func contains(list []string, target string) bool {
-	for _, item := range list {
-		if item == target {
-			return true
+// ScanDir returns the supported media files at or below dir, which should be
+// one of the media directories.
+func (config *Config) ScanDir(dir string) ([]MediaFile, error) {
+	var files []MediaFile
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return nil
+		}
+
+		if file, ok := config.NewMediaFile(path, info); ok {
+			files = append(files, file)
 		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
-	return false
+	return files, nil
 }
 
-func hashFilePath(path string) string {
-	hash := sha1.Sum([]byte(path))
-	return fmt.Sprintf("%x", hash)
+// ThumbnailCache returns the thumbnail cache directory and its size limit in
+// bytes, falling back to the defaults for unset values.
+func (config *Config) ThumbnailCache() (dir string, maxBytes int64) {
+	dir = config.ThumbnailCacheDir
+	if dir == "" {
+		dir = DefaultThumbnailCacheDir
+	}
+	sizeMB := config.ThumbnailCacheSizeMB
+	if sizeMB <= 0 {
+		sizeMB = DefaultThumbnailCacheSizeMB
+	}
+	return dir, int64(sizeMB) << 20
 }
 
-func (config *Config) SaveConfig() error {
-	configLock.Lock()
-	defer configLock.Unlock()
+// IsSupported reports whether the file at path has one of the extensions
+// to scan for, ignoring case.
+func (config *Config) IsSupported(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return contains(config.getRegistry().exts, ext)
+}
 
-	data, err := json.MarshalIndent(config, "", "  ")
-	if err != nil {
-		return err
+// NewMediaFile builds the MediaFile for path, returning false when the file
+// is a directory or its extension isn't supported.
+func (config *Config) NewMediaFile(path string, info os.FileInfo) (MediaFile, bool) {
+	if info.IsDir() || !config.IsSupported(path) {
+		return MediaFile{}, false
 	}
-	return os.WriteFile(configPath, data, 0644)
+	return MediaFile{
+		ID:   MediaID(path),
+		Name: info.Name(),
+		Path: path,
+		Ext:  strings.ToLower(filepath.Ext(path)),
+		Root: config.RootFor(path),
+		Type: config.KindOf(path),
+	}, true
 }
-func (config *Config) AddMediaDir(newDir string) error {
-	configLock.Lock()
-	defer configLock.Unlock()
 
-	// Normalize path (optional but good)
-	newDir = filepath.Clean(newDir)
-
-	// Check if already exists
-	for _, d := range config.MediaDirs {
-		if d == newDir {
-			return errors.New("folder already exists")
+// RootFor returns the configured media directory containing path, or an
+// empty string if it isn't inside any of them. With nested directories the
+// innermost one wins.
+func (config *Config) RootFor(path string) string {
+	path = filepath.Clean(path)
+	root := ""
+	for _, dir := range config.MediaDirs {
+		dir = filepath.Clean(dir)
+		if IsWithin(path, dir) && len(dir) > len(root) {
+			root = dir
 		}
 	}
-
-	config.MediaDirs = append(config.MediaDirs, newDir)
-	return config.SaveConfig()
+	return root
 }
-func (config *Config) RemoveMediaDir(dirToRemove string) error {
-	configLock.Lock()
-	defer configLock.Unlock()
-
-	dirToRemove = filepath.Clean(dirToRemove)
-
-	newDirs := make([]string, 0, len(config.MediaDirs))
-	found := false
-	for _, d := range config.MediaDirs {
-		if d == dirToRemove {
-			found = true
-			continue
-		}
-		newDirs = append(newDirs, d)
+
+// IsWithin reports whether path is dir itself or lies below it. Both paths
+// must be clean.
+func IsWithin(path string, dir string) bool {
+	if path == dir {
+		return true
 	}
-	if !found {
-		return errors.New("folder not found")
+	if !strings.HasSuffix(dir, string(filepath.Separator)) {
+		dir += string(filepath.Separator)
 	}
+	return strings.HasPrefix(path, dir)
+}
 
-	config.MediaDirs = newDirs
-	return config.SaveConfig()
+// MediaID returns the stable ID used for the media file at path.
+func MediaID(path string) string {
+	return hashFilePath(path)
 }
-func (config *Config) ToggleStreamOnDemand() error {
-	configLock.Lock()
-	defer configLock.Unlock()
 
-	config.StreamOnDemand = !config.StreamOnDemand
-	return config.SaveConfig()
+func contains(list []string, target string) bool {
+	for _, item := range list {
+		if item == target {
+			return true
+		}
+	}
+	return false
 }
 
-// FetchConfig reloads the config from file, useful for syncing changes
-func FetchConfig() (*Config, error) {
-	return LoadConfig()
+func hashFilePath(path string) string {
+	hash := sha1.Sum([]byte(path))
+	return fmt.Sprintf("%x", hash)
 }
@@ -0,0 +1,202 @@
+package media
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+)
+
+// probeTimeout bounds how long a single ffprobe run may take so one broken
+// file can't stall a scan.
+const probeTimeout = 30 * time.Second
+
+// ProbeResult holds the technical metadata ffprobe reports for a media file.
+type ProbeResult struct {
+	Duration   float64
+	Container  string
+	VideoCodec string
+	AudioCodec string
+	Width      int
+	Height     int
+	FrameRate  float64
+	Bitrate    int64
+	Size       int64
+	Tracks     []Track
+	Chapters   []Chapter
+}
+
+// Track is a single audio or subtitle stream inside a media file.
+type Track struct {
+	StreamIndex int
+	Kind        string
+	Codec       string
+	Language    string
+	Title       string
+	Channels    int
+	Default     bool
+}
+
+// Chapter is a named section of a media file, in seconds.
+type Chapter struct {
+	Title string
+	Start float64
+	End   float64
+}
+
+type ffprobeOutput struct {
+	Format struct {
+		FormatName string `json:"format_name"`
+		Duration   string `json:"duration"`
+		Size       string `json:"size"`
+		BitRate    string `json:"bit_rate"`
+	} `json:"format"`
+	Streams []struct {
+		Index        int               `json:"index"`
+		CodecType    string            `json:"codec_type"`
+		CodecName    string            `json:"codec_name"`
+		Width        int               `json:"width"`
+		Height       int               `json:"height"`
+		AvgFrameRate string            `json:"avg_frame_rate"`
+		RFrameRate   string            `json:"r_frame_rate"`
+		Channels     int               `json:"channels"`
+		Tags         map[string]string `json:"tags"`
+		Disposition  map[string]int    `json:"disposition"`
+	} `json:"streams"`
+	Chapters []struct {
+		StartTime string            `json:"start_time"`
+		EndTime   string            `json:"end_time"`
+		Tags      map[string]string `json:"tags"`
+	} `json:"chapters"`
+}
+
+// Probe runs ffprobe against path and extracts its technical metadata.
+func Probe(path string) (*ProbeResult, error) {
+	raw, err := ffmpeg.ProbeWithTimeout(path, probeTimeout, ffmpeg.KwArgs{
+		"v":             "error",
+		"show_chapters": "",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("ffprobe error: %w", err)
+	}
+
+	var out ffprobeOutput
+	if err := json.Unmarshal([]byte(raw), &out); err != nil {
+		return nil, fmt.Errorf("failed to parse ffprobe output: %w", err)
+	}
+
+	result := &ProbeResult{
+		Duration:  parseFloat(out.Format.Duration),
+		Container: containerName(out.Format.FormatName, filepath.Ext(path)),
+		Bitrate:   parseInt(out.Format.BitRate),
+		Size:      parseInt(out.Format.Size),
+	}
+
+	for _, stream := range out.Streams {
+		switch stream.CodecType {
+		case "video":
+			// Cover art is exposed as a video stream; it isn't the picture.
+			if stream.Disposition["attached_pic"] == 1 || result.VideoCodec != "" {
+				continue
+			}
+			result.VideoCodec = stream.CodecName
+			result.Width = stream.Width
+			result.Height = stream.Height
+			result.FrameRate = parseRate(stream.AvgFrameRate)
+			if result.FrameRate == 0 {
+				result.FrameRate = parseRate(stream.RFrameRate)
+			}
+		case "audio", "subtitle":
+			if stream.CodecType == "audio" && result.AudioCodec == "" {
+				result.AudioCodec = stream.CodecName
+			}
+			result.Tracks = append(result.Tracks, Track{
+				StreamIndex: stream.Index,
+				Kind:        stream.CodecType,
+				Codec:       stream.CodecName,
+				Language:    stream.Tags["language"],
+				Title:       stream.Tags["title"],
+				Channels:    stream.Channels,
+				Default:     stream.Disposition["default"] == 1,
+			})
+		}
+	}
+
+	for _, chapter := range out.Chapters {
+		result.Chapters = append(result.Chapters, Chapter{
+			Title: chapter.Tags["title"],
+			Start: parseFloat(chapter.StartTime),
+			End:   parseFloat(chapter.EndTime),
+		})
+	}
+
+	return result, nil
+}
+
+var (
+	browserContainers  = []string{"mp4", "webm", "mp3", "ogg", "wav", "flac"}
+	browserVideoCodecs = []string{"", "h264", "vp8", "vp9", "av1"}
+	browserAudioCodecs = []string{"", "aac", "mp3", "opus", "vorbis", "flac"}
+
+	// Browser-playable codecs that can also be carried in an MP4 container.
+	mp4VideoCodecs = []string{"", "h264", "vp9", "av1"}
+	mp4AudioCodecs = []string{"", "aac", "mp3", "opus", "flac"}
+)
+
+// DirectPlayable reports whether browsers can usually play the file as-is,
+// without remuxing or transcoding.
+func (p *ProbeResult) DirectPlayable() bool {
+	return contains(browserContainers, p.Container) &&
+		contains(browserVideoCodecs, p.VideoCodec) &&
+		contains(browserAudioCodecs, p.AudioCodec)
+}
+
+// Remuxable reports whether streams with these codecs play in browsers once
+// copied into an MP4 container, so only the container has to change.
+func Remuxable(videoCodec string, audioCodec string) bool {
+	return contains(mp4VideoCodecs, videoCodec) && contains(mp4AudioCodecs, audioCodec)
+}
+
+// containerName turns ffprobe's demuxer list (e.g. "mov,mp4,m4a,3gp") into a
+// single, friendlier container name.
+func containerName(formatName string, ext string) string {
+	ext = strings.TrimPrefix(strings.ToLower(ext), ".")
+	formats := strings.Split(formatName, ",")
+
+	switch {
+	case contains(formats, "mp4") && (ext == "mp4" || ext == "m4v" || ext == "m4a"):
+		return "mp4"
+	case contains(formats, "webm") && ext == "webm":
+		return "webm"
+	case contains(formats, "matroska"):
+		return "mkv"
+	}
+	return formats[0]
+}
+
+func parseFloat(value string) float64 {
+	f, _ := strconv.ParseFloat(value, 64)
+	return f
+}
+
+func parseInt(value string) int64 {
+	i, _ := strconv.ParseInt(value, 10, 64)
+	return i
+}
+
+// parseRate parses ffprobe rationals such as "30000/1001".
+func parseRate(value string) float64 {
+	num, den, found := strings.Cut(value, "/")
+	if !found {
+		return parseFloat(value)
+	}
+	d := parseFloat(den)
+	if d == 0 {
+		return 0
+	}
+	return parseFloat(num) / d
+}
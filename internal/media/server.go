@@ -0,0 +1,246 @@
+package media
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	DefaultConfigPath = "config.json"
+	DefaultHTTPPort   = 8000
+	DefaultWSPort     = 9000
+	DefaultDBPath     = "media.db"
+	// AdminPasswordFile holds the password of the account created on first
+	// run, see ServerSettings.AdminPasswordPath.
+	AdminPasswordFile = "admin_password.txt"
+)
+
+// Names of the server settings that can be overridden. Each is a flag, and
+// an environment variable named MEDIA_SERVER_ plus the name in upper case
+// with dashes turned into underscores, e.g. MEDIA_SERVER_HTTP_PORT.
+const (
+	SettingConfig      = "config"
+	SettingBind        = "bind"
+	SettingHTTPPort    = "http-port"
+	SettingWSPort      = "ws-port"
+	SettingCORSOrigins = "cors-origins"
+	SettingDB          = "db"
+	SettingSwaggerURL  = "swagger-url"
+)
+
+var settingUsage = []struct{ name, usage string }{
+	{SettingConfig, "path of the config file (default " + DefaultConfigPath + ")"},
+	{SettingBind, "address to listen on, all interfaces by default"},
+	{SettingHTTPPort, fmt.Sprintf("port of the HTTP API (default %d)", DefaultHTTPPort)},
+	{SettingWSPort, fmt.Sprintf("port of the websocket server (default %d)", DefaultWSPort)},
+	{SettingCORSOrigins, "comma-separated origins allowed by CORS"},
+	{SettingDB, "path of the SQLite database (default " + DefaultDBPath + ")"},
+	{SettingSwaggerURL, "URL the API docs load doc.json from"},
+}
+
+// EnvName returns the environment variable that overrides setting.
+func EnvName(setting string) string {
+	return "MEDIA_SERVER_" + strings.ToUpper(strings.ReplaceAll(setting, "-", "_"))
+}
+
+// Overrides holds the server settings given on the command line or in the
+// environment, by setting name. Flags win over environment variables, and
+// both win over config.json. Empty environment variables are ignored.
+type Overrides map[string]string
+
+// ParseOverrides reads the overrides from the command line arguments args
+// and the environment through lookupEnv. It returns flag.ErrHelp if help
+// was asked for.
+func ParseOverrides(name string, args []string, lookupEnv func(string) (string, bool)) (Overrides, error) {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	for _, s := range settingUsage {
+		flags.String(s.name, "", s.usage+" [$"+EnvName(s.name)+"]")
+	}
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+	if flags.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected argument %q", flags.Arg(0))
+	}
+
+	overrides := Overrides{}
+	for _, s := range settingUsage {
+		if value, ok := lookupEnv(EnvName(s.name)); ok && value != "" {
+			overrides[s.name] = value
+		}
+	}
+	flags.Visit(func(f *flag.Flag) {
+		overrides[f.Name] = f.Value.String()
+	})
+	return overrides, nil
+}
+
+// ConfigPath returns the path of the config file to load.
+func (o Overrides) ConfigPath() string {
+	if path := o[SettingConfig]; path != "" {
+		return path
+	}
+	return DefaultConfigPath
+}
+
+// ServerSettings are the settings the servers are started with. Unlike the
+// rest of the config they are only read at startup.
+type ServerSettings struct {
+	BindAddress string
+	HTTPPort    int
+	WSPort      int
+	// CORSOrigins are the origins allowed to call the HTTP API.
+	CORSOrigins []string
+	DBPath      string
+	SwaggerURL  string
+}
+
+// HTTPAddr returns the address the HTTP API listens on.
+func (s ServerSettings) HTTPAddr() string {
+	return net.JoinHostPort(s.BindAddress, strconv.Itoa(s.HTTPPort))
+}
+
+// AdminPasswordPath returns the file the password of the account created
+// on first run is written to, next to the database.
+func (s ServerSettings) AdminPasswordPath() string {
+	dbPath, _, _ := strings.Cut(s.DBPath, "?")
+	return filepath.Join(filepath.Dir(dbPath), AdminPasswordFile)
+}
+
+// WSAddr returns the address the websocket server listens on.
+func (s ServerSettings) WSAddr() string {
+	return net.JoinHostPort(s.BindAddress, strconv.Itoa(s.WSPort))
+}
+
+// ServerSettings combines the server settings in config with overrides,
+// falling back to the defaults for settings given nowhere. Without any
+// configured CORS origins the local development servers are allowed. A port
+// of 0 in config.json means the default; ports outside 1-65535 and the same
+// port for both servers are rejected.
+func (config *Config) ServerSettings(overrides Overrides) (ServerSettings, error) {
+	settings := ServerSettings{
+		BindAddress: config.BindAddress,
+		HTTPPort:    config.HTTPPort,
+		WSPort:      config.WSPort,
+		CORSOrigins: config.CORSOrigins,
+		DBPath:      config.DBPath,
+		SwaggerURL:  config.SwaggerURL,
+	}
+
+	var errs []error
+	for _, s := range settingUsage {
+		value, ok := overrides[s.name]
+		if !ok {
+			continue
+		}
+		switch s.name {
+		case SettingBind:
+			settings.BindAddress = value
+		case SettingHTTPPort, SettingWSPort:
+			port, err := parsePort(value)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", s.name, err))
+				continue
+			}
+			if s.name == SettingHTTPPort {
+				settings.HTTPPort = port
+			} else {
+				settings.WSPort = port
+			}
+		case SettingCORSOrigins:
+			settings.CORSOrigins = splitList(value)
+		case SettingDB:
+			settings.DBPath = value
+		case SettingSwaggerURL:
+			settings.SwaggerURL = value
+		}
+	}
+	// Ports from config.json that no flag or environment variable replaces
+	// are checked too, so a bad one is reported now rather than as a bind
+	// error once the servers start.
+	for _, p := range []struct {
+		setting, field string
+		port           int
+	}{
+		{SettingHTTPPort, "http_port", config.HTTPPort},
+		{SettingWSPort, "ws_port", config.WSPort},
+	} {
+		if _, ok := overrides[p.setting]; !ok && (p.port < 0 || p.port > 65535) {
+			errs = append(errs, fmt.Errorf("%s: invalid port %d, must be between 1 and 65535", p.field, p.port))
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return ServerSettings{}, err
+	}
+
+	if settings.HTTPPort == 0 {
+		settings.HTTPPort = DefaultHTTPPort
+	}
+	if settings.WSPort == 0 {
+		settings.WSPort = DefaultWSPort
+	}
+	if settings.HTTPPort == settings.WSPort {
+		return ServerSettings{}, fmt.Errorf("the HTTP API and the websocket server can't both use port %d", settings.HTTPPort)
+	}
+	if settings.DBPath == "" {
+		settings.DBPath = DefaultDBPath
+	}
+	if settings.SwaggerURL == "" {
+		settings.SwaggerURL = fmt.Sprintf("http://localhost:%d/docs/doc.json", settings.HTTPPort)
+	}
+	if len(settings.CORSOrigins) == 0 {
+		settings.CORSOrigins = defaultCORSOrigins(settings.HTTPPort)
+	}
+	return settings, nil
+}
+
+// defaultCORSOrigins allows the frontend's dev and preview servers, on
+// localhost and on the first LAN address, and the API itself.
+func defaultCORSOrigins(httpPort int) []string {
+	hosts := []string{"localhost", "127.0.0.1"}
+	if addrs, err := net.InterfaceAddrs(); err == nil {
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok && !ipNet.IP.IsLoopback() {
+				if ip := ipNet.IP.To4(); ip != nil {
+					hosts = append(hosts, ip.String())
+					break
+				}
+			}
+		}
+	}
+
+	var origins []string
+	for _, host := range hosts {
+		for _, port := range []int{5173, 4173} {
+			origins = append(origins, fmt.Sprintf("http://%s:%d", host, port))
+		}
+	}
+	return append(origins,
+		fmt.Sprintf("http://127.0.0.1:%d", httpPort),
+		fmt.Sprintf("http://localhost:%d", httpPort),
+		"http://localhost:8080",
+	)
+}
+
+func parsePort(value string) (int, error) {
+	port, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || port < 1 || port > 65535 {
+		return 0, fmt.Errorf("invalid port %q, must be between 1 and 65535", value)
+	}
+	return port, nil
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
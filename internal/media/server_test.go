@@ -0,0 +1,152 @@
+package media
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestServerSettings(t *testing.T) {
+	config := &Config{
+		BindAddress: "10.0.0.2",
+		HTTPPort:    8100,
+		WSPort:      9100,
+		CORSOrigins: []string{"http://config"},
+		DBPath:      "config.db",
+	}
+
+	tests := []struct {
+		name   string
+		config *Config
+		args   []string
+		env    map[string]string
+		want   ServerSettings
+	}{
+		{
+			name:   "defaults",
+			config: &Config{CORSOrigins: []string{"http://app"}},
+			want: ServerSettings{
+				HTTPPort:    DefaultHTTPPort,
+				WSPort:      DefaultWSPort,
+				CORSOrigins: []string{"http://app"},
+				DBPath:      DefaultDBPath,
+				SwaggerURL:  "http://localhost:8000/docs/doc.json",
+			},
+		},
+		{
+			name:   "config",
+			config: config,
+			want: ServerSettings{
+				BindAddress: "10.0.0.2",
+				HTTPPort:    8100,
+				WSPort:      9100,
+				CORSOrigins: []string{"http://config"},
+				DBPath:      "config.db",
+				SwaggerURL:  "http://localhost:8100/docs/doc.json",
+			},
+		},
+		{
+			name:   "environment over config",
+			config: config,
+			env: map[string]string{
+				"MEDIA_SERVER_HTTP_PORT":    "8200",
+				"MEDIA_SERVER_CORS_ORIGINS": "http://a, http://b,",
+				"MEDIA_SERVER_DB":           "",
+			},
+			want: ServerSettings{
+				BindAddress: "10.0.0.2",
+				HTTPPort:    8200,
+				WSPort:      9100,
+				CORSOrigins: []string{"http://a", "http://b"},
+				DBPath:      "config.db",
+				SwaggerURL:  "http://localhost:8200/docs/doc.json",
+			},
+		},
+		{
+			name:   "flags over environment",
+			config: config,
+			args:   []string{"-http-port", "8300", "-bind", "127.0.0.1", "-db=flag.db", "-swagger-url", "http://docs"},
+			env:    map[string]string{"MEDIA_SERVER_HTTP_PORT": "8200", "MEDIA_SERVER_WS_PORT": "9200"},
+			want: ServerSettings{
+				BindAddress: "127.0.0.1",
+				HTTPPort:    8300,
+				WSPort:      9200,
+				CORSOrigins: []string{"http://config"},
+				DBPath:      "flag.db",
+				SwaggerURL:  "http://docs",
+			},
+		},
+		{
+			name:   "override replaces an invalid config port",
+			config: &Config{HTTPPort: 70000, CORSOrigins: []string{"http://app"}},
+			args:   []string{"-http-port", "8000"},
+			want: ServerSettings{
+				HTTPPort:    8000,
+				WSPort:      DefaultWSPort,
+				CORSOrigins: []string{"http://app"},
+				DBPath:      DefaultDBPath,
+				SwaggerURL:  "http://localhost:8000/docs/doc.json",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := serverSettings(t, tt.config, tt.args, tt.env)
+			if got.BindAddress != tt.want.BindAddress || got.HTTPPort != tt.want.HTTPPort ||
+				got.WSPort != tt.want.WSPort || got.DBPath != tt.want.DBPath ||
+				got.SwaggerURL != tt.want.SwaggerURL || !slices.Equal(got.CORSOrigins, tt.want.CORSOrigins) {
+				t.Errorf("ServerSettings = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestServerSettingsInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  *Config
+		args    []string
+		env     map[string]string
+		wantErr string
+	}{
+		{"flag port zero", &Config{}, []string{"-ws-port", "0"}, nil, `ws-port: invalid port "0"`},
+		{"flag port not a number", &Config{}, []string{"-http-port", "web"}, nil, `http-port: invalid port "web"`},
+		{"environment port too big", &Config{}, nil, map[string]string{"MEDIA_SERVER_HTTP_PORT": "65536"}, `http-port: invalid port "65536"`},
+		{"config port too big", &Config{HTTPPort: 70000}, nil, nil, "http_port: invalid port 70000"},
+		{"config port negative", &Config{WSPort: -1}, nil, nil, "ws_port: invalid port -1"},
+		{"same port", &Config{HTTPPort: 9000}, nil, nil, "can't both use port 9000"},
+		{"same port by flag", &Config{}, []string{"-ws-port", "8000"}, nil, "can't both use port 8000"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			overrides, err := ParseOverrides("media_server", tt.args, lookupIn(tt.env))
+			if err != nil {
+				t.Fatalf("ParseOverrides: %v", err)
+			}
+			_, err = tt.config.ServerSettings(overrides)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ServerSettings error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func serverSettings(t *testing.T, config *Config, args []string, env map[string]string) ServerSettings {
+	t.Helper()
+	overrides, err := ParseOverrides("media_server", args, lookupIn(env))
+	if err != nil {
+		t.Fatalf("ParseOverrides: %v", err)
+	}
+	settings, err := config.ServerSettings(overrides)
+	if err != nil {
+		t.Fatalf("ServerSettings: %v", err)
+	}
+	return settings
+}
+
+func lookupIn(env map[string]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	}
+}
@@ -0,0 +1,278 @@
+package media
+
+import (
+	"encoding/json"
+	"errors"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrMediaDirNotFound is returned when removing a directory that isn't a
+// configured media directory.
+var ErrMediaDirNotFound = errors.New("folder not found")
+
+// ConfigStore owns the config: it keeps the current version in memory,
+// persists changes to the config file and tells subscribers about them.
+//
+// The *Config values it hands out are shared snapshots and must not be
+// modified; changes go through Update, or Reload for edits made to the file.
+type ConfigStore struct {
+	path    string
+	current atomic.Pointer[versioned]
+
+	// mu serialises updates and guards the fields below.
+	mu          sync.Mutex
+	subscribers []subscriber
+	nextID      int
+	// pending holds the configs subscribers haven't been told about yet, in
+	// version order; delivering is set while they are being told.
+	pending    []*versioned
+	delivering bool
+}
+
+type subscriber struct {
+	id int
+	fn func(config *Config, version uint64)
+}
+
+type versioned struct {
+	config  *Config
+	version uint64
+}
+
+// NewConfigStore loads the config file at path.
+func NewConfigStore(path string) (*ConfigStore, error) {
+	config, err := LoadConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	store := &ConfigStore{path: path}
+	store.current.Store(&versioned{config: config, version: 1})
+	return store, nil
+}
+
+// LoadConfig reads the config file at path.
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var config Config
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, err
+	}
+	config.index()
+	return &config, nil
+}
+
+// Path returns the path of the config file.
+func (s *ConfigStore) Path() string {
+	return s.path
+}
+
+// Get returns the current config.
+func (s *ConfigStore) Get() *Config {
+	return s.current.Load().config
+}
+
+// Version returns the version of the current config. It starts at 1 and
+// goes up by one with every change.
+func (s *ConfigStore) Version() uint64 {
+	return s.current.Load().version
+}
+
+// Subscribe calls fn with every new config, in version order, until the
+// returned function is called. Subscribers are called one after the other,
+// in the order they subscribed, once the store is unlocked: fn may read the
+// store or update it, and a slow fn only delays the caller whose change is
+// being delivered.
+func (s *ConfigStore) Subscribe(fn func(config *Config, version uint64)) (unsubscribe func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := s.nextID
+	s.nextID++
+	s.subscribers = append(s.subscribers, subscriber{id: id, fn: fn})
+	return func() {
+		s.mu.Lock()
+		s.subscribers = slices.DeleteFunc(s.subscribers, func(sub subscriber) bool {
+			return sub.id == id
+		})
+		s.mu.Unlock()
+	}
+}
+
+// Update applies change to a copy of the current config, saves it and makes
+// it current. Nothing is changed if change or saving fails.
+func (s *ConfigStore) Update(change func(config *Config) error) (*Config, error) {
+	defer s.notify()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	config := s.Get().clone()
+	if err := change(config); err != nil {
+		return nil, err
+	}
+	if err := writeFileAtomic(s.path, config); err != nil {
+		return nil, err
+	}
+	s.set(config)
+	return config, nil
+}
+
+// Reload reads the config file again and, if it changed, validates it
+// against the current config with Validate and makes it current. The file
+// is left as it is, also when it is rejected.
+func (s *ConfigStore) Reload() (changed bool, err error) {
+	defer s.notify()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	config, err := LoadConfig(s.path)
+	if err != nil {
+		return false, err
+	}
+	current := s.Get()
+	if config.Equal(current) {
+		return false, nil
+	}
+	if err := config.Validate(current); err != nil {
+		return false, err
+	}
+	// Validate may have only resolved the paths of media directories.
+	if config.Equal(current) {
+		return false, nil
+	}
+	s.set(config)
+	return true, nil
+}
+
+// set makes config current and queues it for the subscribers, who are told
+// by notify. s.mu must be held.
+func (s *ConfigStore) set(config *Config) {
+	config.index()
+	current := &versioned{config: config, version: s.Version() + 1}
+	s.current.Store(current)
+	s.pending = append(s.pending, current)
+}
+
+// notify tells the subscribers about pending configs. s.mu must not be
+// held. Only one caller delivers at a time, so subscribers see the configs
+// in order; changes made meanwhile, including by the subscribers
+// themselves, are delivered by that caller too.
+func (s *ConfigStore) notify() {
+	s.mu.Lock()
+	if s.delivering {
+		s.mu.Unlock()
+		return
+	}
+	s.delivering = true
+	for len(s.pending) > 0 {
+		next := s.pending[0]
+		s.pending = s.pending[1:]
+		subscribers := slices.Clone(s.subscribers)
+		s.mu.Unlock()
+
+		for _, sub := range subscribers {
+			sub.fn(next.config, next.version)
+		}
+		s.mu.Lock()
+	}
+	s.delivering = false
+	s.mu.Unlock()
+}
+
+// AddMediaDir validates dir with ValidateMediaDir and adds it to the media
+// directories. It returns the new config and the directory as stored.
+func (s *ConfigStore) AddMediaDir(dir string) (*Config, string, error) {
+	var added string
+	config, err := s.Update(func(config *Config) error {
+		resolved, err := config.ValidateMediaDir(dir)
+		if err != nil {
+			return err
+		}
+		added = resolved
+		config.MediaDirs = append(config.MediaDirs, resolved)
+		return nil
+	})
+	return config, added, err
+}
+
+// RemoveMediaDir removes dir from the media directories. dir may be given
+// as configured or as it was given to AddMediaDir, which stores it resolved.
+func (s *ConfigStore) RemoveMediaDir(dir string) (*Config, error) {
+	if dir == "" {
+		return nil, &FolderError{Path: dir, Reason: ReasonEmpty}
+	}
+	cleaned := filepath.Clean(dir)
+	// A directory that has gone missing can only be removed as configured.
+	resolved, err := resolveDir(dir)
+	if err != nil {
+		resolved = cleaned
+	}
+	return s.Update(func(config *Config) error {
+		dirs := slices.DeleteFunc(config.MediaDirs, func(d string) bool {
+			d = filepath.Clean(d)
+			return d == cleaned || d == resolved
+		})
+		if len(dirs) == len(config.MediaDirs) {
+			return ErrMediaDirNotFound
+		}
+		config.MediaDirs = dirs
+		return nil
+	})
+}
+
+// ToggleStreamOnDemand flips between on-demand streaming and
+// pre-transcoding.
+func (s *ConfigStore) ToggleStreamOnDemand() (*Config, error) {
+	return s.Update(func(config *Config) error {
+		config.StreamOnDemand = !config.StreamOnDemand
+		return nil
+	})
+}
+
+func (config *Config) clone() *Config {
+	c := *config
+	c.MediaDirs = slices.Clone(config.MediaDirs)
+	c.SupportedExtensions = slices.Clone(config.SupportedExtensions)
+	c.MediaKinds = maps.Clone(config.MediaKinds)
+	c.registry = nil
+	c.CORSOrigins = slices.Clone(config.CORSOrigins)
+	return &c
+}
+
+// writeFileAtomic saves config to path by writing a temporary file next to
+// it and renaming it over path, so readers never see a partial file.
+func writeFileAtomic(path string, config *Config) error {
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
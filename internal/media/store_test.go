@@ -0,0 +1,79 @@
+package media
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func newTestStore(t *testing.T) *ConfigStore {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(`{"media_dirs": []}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	store, err := NewConfigStore(path)
+	if err != nil {
+		t.Fatalf("NewConfigStore: %v", err)
+	}
+	return store
+}
+
+func TestConfigStoreSubscribers(t *testing.T) {
+	store := newTestStore(t)
+
+	var calls []string
+	record := func(name string) func(*Config, uint64) {
+		return func(config *Config, version uint64) {
+			calls = append(calls, fmt.Sprintf("%s:%d", name, version))
+		}
+	}
+	store.Subscribe(record("a"))
+	unsubscribe := store.Subscribe(record("b"))
+	// A subscriber may read and update the store; its change is delivered
+	// after the current one, to everyone.
+	store.Subscribe(func(config *Config, version uint64) {
+		if store.Version() < version {
+			t.Errorf("store at version %d while delivering %d", store.Version(), version)
+		}
+		if version == 2 {
+			if _, err := store.ToggleStreamOnDemand(); err != nil {
+				t.Errorf("ToggleStreamOnDemand from a subscriber: %v", err)
+			}
+		}
+	})
+	store.Subscribe(record("c"))
+
+	if _, err := store.ToggleStreamOnDemand(); err != nil {
+		t.Fatalf("ToggleStreamOnDemand: %v", err)
+	}
+	unsubscribe()
+	if _, err := store.ToggleStreamOnDemand(); err != nil {
+		t.Fatalf("ToggleStreamOnDemand: %v", err)
+	}
+
+	want := []string{"a:2", "b:2", "c:2", "a:3", "b:3", "c:3", "a:4", "c:4"}
+	if !slices.Equal(calls, want) {
+		t.Errorf("calls = %v, want %v", calls, want)
+	}
+	if store.Version() != 4 || !store.Get().StreamOnDemand {
+		t.Errorf("store at version %d with on_demand %v, want 4 and true", store.Version(), store.Get().StreamOnDemand)
+	}
+}
+
+func TestConfigStoreOmitsUnsetExtensions(t *testing.T) {
+	store := newTestStore(t)
+	if _, err := store.ToggleStreamOnDemand(); err != nil {
+		t.Fatalf("ToggleStreamOnDemand: %v", err)
+	}
+	data, err := os.ReadFile(store.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "null") {
+		t.Errorf("config file holds a null:\n%s", data)
+	}
+}
@@ -0,0 +1,258 @@
+package share
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	database "media_server/internal/db"
+	"media_server/internal/logger"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultTTL is how long a link stays valid when no expiry is given.
+	DefaultTTL = 24 * time.Hour
+	// MaxTTL is the longest expiry a link may be given.
+	MaxTTL = 30 * 24 * time.Hour
+
+	// flushInterval is how often use counts are written back to the
+	// database.
+	flushInterval = 30 * time.Second
+
+	secretSetting = "share_secret"
+)
+
+var (
+	ErrInvalid   = errors.New("invalid share link")
+	ErrExpired   = errors.New("share link expired")
+	ErrRevoked   = errors.New("share link revoked")
+	ErrExhausted = errors.New("share link has been used up")
+)
+
+type link struct {
+	mediaID   string
+	userID    uint
+	expiresAt time.Time
+	maxUses   int
+	uses      int
+	revoked   bool
+}
+
+// Manager signs share links and validates them. The signature and expiry are
+// part of the URL and the revocation and use-count state of every active link
+// is kept in memory, so checking a link never touches the database; use
+// counts are written back in the background.
+type Manager struct {
+	db     *database.DBObject
+	secret []byte
+
+	mu    sync.Mutex
+	links map[string]*link
+	dirty map[string]int
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewManager loads the signing secret, creating one on first run, and the
+// state of every active link.
+func NewManager(db *database.DBObject) (*Manager, error) {
+	secret, err := db.SettingOrCreate(secretSetting, database.RandomToken)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load share secret: %w", err)
+	}
+	active, err := db.ActiveShareLinks()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load share links: %w", err)
+	}
+
+	m := &Manager{
+		db:     db,
+		secret: []byte(secret),
+		links:  make(map[string]*link, len(active)),
+		dirty:  make(map[string]int),
+		done:   make(chan struct{}),
+	}
+	for _, l := range active {
+		m.links[l.ID] = &link{mediaID: l.MediaID, userID: l.UserID, expiresAt: l.ExpiresAt, maxUses: l.MaxUses, uses: l.Uses}
+	}
+	return m, nil
+}
+
+// Start writes use counts back and forgets expired links periodically until
+// Close is called.
+func (m *Manager) Start() {
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		ticker := time.NewTicker(flushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-m.done:
+				m.flush()
+				return
+			case <-ticker.C:
+				m.flush()
+				m.prune()
+			}
+		}
+	}()
+}
+
+// Close stops the background writer after a final flush.
+func (m *Manager) Close() {
+	close(m.done)
+	m.wg.Wait()
+}
+
+// Create stores a new link to mediaID for userID and returns it with its
+// signed query string.
+func (m *Manager) Create(mediaID string, userID uint, ttl time.Duration, maxUses int) (database.ShareLink, url.Values, error) {
+	id, err := database.RandomToken()
+	if err != nil {
+		return database.ShareLink{}, nil, err
+	}
+	shareLink := database.ShareLink{
+		ID:        id[:22],
+		MediaID:   mediaID,
+		UserID:    userID,
+		ExpiresAt: time.Now().Add(ttl).Truncate(time.Second),
+		MaxUses:   maxUses,
+	}
+	if err := m.db.CreateShareLink(&shareLink); err != nil {
+		return shareLink, nil, err
+	}
+
+	m.mu.Lock()
+	m.links[shareLink.ID] = &link{mediaID: mediaID, userID: userID, expiresAt: shareLink.ExpiresAt, maxUses: maxUses}
+	m.mu.Unlock()
+
+	return shareLink, m.sign(shareLink.ID, mediaID, shareLink.ExpiresAt), nil
+}
+
+// Revoke stops a link from working.
+func (m *Manager) Revoke(id string) error {
+	if err := m.db.RevokeShareLink(id); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	if l, ok := m.links[id]; ok {
+		l.revoked = true
+	}
+	m.mu.Unlock()
+	return nil
+}
+
+// RevokeUser forgets the links of userID, whose account was deleted along
+// with them.
+func (m *Manager) RevokeUser(userID uint) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for id, l := range m.links {
+		if l.userID == userID {
+			delete(m.links, id)
+			delete(m.dirty, id)
+		}
+	}
+}
+
+// Uses returns the in-memory use count of a link, which may be ahead of the
+// database.
+func (m *Manager) Uses(id string) (int, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	l, ok := m.links[id]
+	if !ok {
+		return 0, false
+	}
+	return l.uses, true
+}
+
+// Validate checks the share parameters of a request for mediaID. When use is
+// set the request counts against the link's max uses.
+func (m *Manager) Validate(query url.Values, mediaID string, use bool) error {
+	id := query.Get("share")
+	expires, err := strconv.ParseInt(query.Get("exp"), 10, 64)
+	if id == "" || err != nil {
+		return ErrInvalid
+	}
+	expected := m.sign(id, mediaID, time.Unix(expires, 0)).Get("sig")
+	if !hmac.Equal([]byte(expected), []byte(query.Get("sig"))) {
+		return ErrInvalid
+	}
+	if time.Now().Unix() >= expires {
+		return ErrExpired
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	l, ok := m.links[id]
+	if !ok || l.mediaID != mediaID {
+		return ErrInvalid
+	}
+	if l.revoked {
+		return ErrRevoked
+	}
+	if l.maxUses > 0 && l.uses >= l.maxUses {
+		return ErrExhausted
+	}
+	if use {
+		l.uses++
+		m.dirty[id] = l.uses
+	}
+	return nil
+}
+
+// sign returns the query parameters authorising access to mediaID through
+// link id until expires.
+func (m *Manager) sign(id string, mediaID string, expires time.Time) url.Values {
+	exp := strconv.FormatInt(expires.Unix(), 10)
+	mac := hmac.New(sha256.New, m.secret)
+	mac.Write([]byte(id + "\n" + mediaID + "\n" + exp))
+	return url.Values{
+		"share": {id},
+		"exp":   {exp},
+		"sig":   {base64.RawURLEncoding.EncodeToString(mac.Sum(nil))},
+	}
+}
+
+// prune drops expired links, which Validate rejects on their signed expiry
+// anyway.
+func (m *Manager) prune() {
+	now := time.Now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for id, l := range m.links {
+		if _, pending := m.dirty[id]; !pending && now.After(l.expiresAt) {
+			delete(m.links, id)
+		}
+	}
+}
+
+func (m *Manager) flush() {
+	m.mu.Lock()
+	if len(m.dirty) == 0 {
+		m.mu.Unlock()
+		return
+	}
+	dirty := m.dirty
+	m.dirty = make(map[string]int)
+	m.mu.Unlock()
+
+	if err := m.db.SetShareLinkUses(dirty); err != nil {
+		logger.Log().Sugar().Errorf("failed to store share link uses: %v", err)
+		m.mu.Lock()
+		for id, uses := range dirty {
+			if _, newer := m.dirty[id]; !newer {
+				m.dirty[id] = uses
+			}
+		}
+		m.mu.Unlock()
+	}
+}
@@ -0,0 +1,175 @@
+package share
+
+import (
+	"errors"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// newTestManager returns a Manager that knows one link, "link1" to
+// "media1", without a database; Validate and sign don't use one.
+func newTestManager(expiresAt time.Time, maxUses int) *Manager {
+	return &Manager{
+		secret: []byte("secret"),
+		links: map[string]*link{
+			"link1": {mediaID: "media1", userID: 1, expiresAt: expiresAt, maxUses: maxUses},
+		},
+		dirty: make(map[string]int),
+	}
+}
+
+func TestValidate(t *testing.T) {
+	expires := time.Now().Add(time.Hour).Truncate(time.Second)
+
+	with := func(query url.Values, key string, value string) url.Values {
+		changed := url.Values{}
+		for k, v := range query {
+			changed[k] = append([]string(nil), v...)
+		}
+		if value == "" {
+			changed.Del(key)
+		} else {
+			changed.Set(key, value)
+		}
+		return changed
+	}
+
+	tests := []struct {
+		name    string
+		query   func(m *Manager) url.Values
+		mediaID string
+		setup   func(m *Manager)
+		want    error
+	}{
+		{
+			name:    "valid",
+			query:   func(m *Manager) url.Values { return m.sign("link1", "media1", expires) },
+			mediaID: "media1",
+		},
+		{
+			name:    "other media",
+			query:   func(m *Manager) url.Values { return m.sign("link1", "media1", expires) },
+			mediaID: "media2",
+			want:    ErrInvalid,
+		},
+		{
+			name: "tampered signature",
+			query: func(m *Manager) url.Values {
+				q := m.sign("link1", "media1", expires)
+				sig := []byte(q.Get("sig"))
+				sig[0] ^= 1
+				return with(q, "sig", string(sig))
+			},
+			mediaID: "media1",
+			want:    ErrInvalid,
+		},
+		{
+			name: "extended expiry",
+			query: func(m *Manager) url.Values {
+				q := m.sign("link1", "media1", expires)
+				return with(q, "exp", strconv.FormatInt(expires.Add(time.Hour).Unix(), 10))
+			},
+			mediaID: "media1",
+			want:    ErrInvalid,
+		},
+		{
+			name: "other link",
+			query: func(m *Manager) url.Values {
+				return with(m.sign("link1", "media1", expires), "share", "link2")
+			},
+			mediaID: "media1",
+			want:    ErrInvalid,
+		},
+		{
+			name: "signed with another secret",
+			query: func(m *Manager) url.Values {
+				other := newTestManager(expires, 0)
+				other.secret = []byte("other secret")
+				return other.sign("link1", "media1", expires)
+			},
+			mediaID: "media1",
+			want:    ErrInvalid,
+		},
+		{
+			name:    "missing signature",
+			query:   func(m *Manager) url.Values { return with(m.sign("link1", "media1", expires), "sig", "") },
+			mediaID: "media1",
+			want:    ErrInvalid,
+		},
+		{
+			name:    "malformed expiry",
+			query:   func(m *Manager) url.Values { return with(m.sign("link1", "media1", expires), "exp", "soon") },
+			mediaID: "media1",
+			want:    ErrInvalid,
+		},
+		{
+			name:    "unknown link",
+			query:   func(m *Manager) url.Values { return m.sign("link2", "media1", expires) },
+			mediaID: "media1",
+			want:    ErrInvalid,
+		},
+		{
+			name:    "expired",
+			query:   func(m *Manager) url.Values { return m.sign("link1", "media1", time.Now().Add(-time.Second)) },
+			mediaID: "media1",
+			want:    ErrExpired,
+		},
+		{
+			name:    "revoked",
+			query:   func(m *Manager) url.Values { return m.sign("link1", "media1", expires) },
+			mediaID: "media1",
+			setup:   func(m *Manager) { m.links["link1"].revoked = true },
+			want:    ErrRevoked,
+		},
+		{
+			name:    "used up",
+			query:   func(m *Manager) url.Values { return m.sign("link1", "media1", expires) },
+			mediaID: "media1",
+			setup: func(m *Manager) {
+				m.links["link1"].maxUses = 2
+				m.links["link1"].uses = 2
+			},
+			want: ErrExhausted,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestManager(expires, 0)
+			if tt.setup != nil {
+				tt.setup(m)
+			}
+			if err := m.Validate(tt.query(m), tt.mediaID, false); !errors.Is(err, tt.want) {
+				t.Errorf("Validate = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateCountsUses(t *testing.T) {
+	m := newTestManager(time.Now().Add(time.Hour), 2)
+	query := m.sign("link1", "media1", time.Now().Add(time.Hour))
+
+	steps := []struct {
+		use  bool
+		want error
+	}{
+		{false, nil},
+		{true, nil},
+		{true, nil},
+		{false, ErrExhausted},
+		{true, ErrExhausted},
+	}
+	for i, step := range steps {
+		if err := m.Validate(query, "media1", step.use); !errors.Is(err, step.want) {
+			t.Fatalf("step %d: Validate(use=%v) = %v, want %v", i, step.use, err, step.want)
+		}
+	}
+	if uses, _ := m.Uses("link1"); uses != 2 {
+		t.Errorf("Uses = %d, want 2", uses)
+	}
+	if m.dirty["link1"] != 2 {
+		t.Errorf("pending use count = %d, want 2", m.dirty["link1"])
+	}
+}
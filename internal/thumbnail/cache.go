@@ -0,0 +1,297 @@
+package thumbnail
+
+import (
+	"container/list"
+	"fmt"
+	database "media_server/internal/db"
+	"media_server/internal/logger"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Cache is an on-disk thumbnail store bounded in size with LRU eviction.
+// Entries are keyed by media ID, the source file's modification time and the
+// requested variant (size, offset, format), so a changed source never hits a
+// stale thumbnail; outdated entries are dropped as soon as a new one is
+// stored.
+type Cache struct {
+	dir      string
+	maxBytes int64
+
+	mu      sync.Mutex
+	lru     *list.List // front is the most recently used entry
+	entries map[string]*list.Element
+	size    int64
+
+	inflightMu sync.Mutex
+	inflight   map[string]*call
+}
+
+type entry struct {
+	key     string
+	mediaID string
+	modTime int64
+	size    int64
+}
+
+// call is a thumbnail generation shared by concurrent requests for the same
+// key, so a burst of requests spawns a single ffmpeg process.
+type call struct {
+	done chan struct{}
+	data []byte
+	err  error
+}
+
+// NewCache opens (creating if needed) the cache in dir and indexes the
+// thumbnails already stored there.
+func NewCache(dir string, maxBytes int64) (*Cache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	c := &Cache{
+		dir:      dir,
+		maxBytes: maxBytes,
+		lru:      list.New(),
+		entries:  make(map[string]*list.Element),
+		inflight: make(map[string]*call),
+	}
+	if err := c.load(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Key returns the cache key of the thumbnail variant described by opts for a
+// media item whose source was last modified at modTime. Keys double as file
+// names inside the cache directory.
+func Key(mediaID string, modTime time.Time, opts Options) string {
+	key := fmt.Sprintf("%s-%d", mediaID, modTime.UnixNano())
+	if variant := opts.variant(); variant != "" {
+		key += "-" + variant
+	}
+	return key + opts.extension()
+}
+
+// GetOrCreate returns the cached thumbnail variant for the media item,
+// calling generate and storing its result on a miss.
+func (c *Cache) GetOrCreate(mediaID string, modTime time.Time, opts Options, generate func() ([]byte, error)) ([]byte, error) {
+	key := Key(mediaID, modTime, opts)
+	if data, ok := c.get(key); ok {
+		return data, nil
+	}
+
+	c.inflightMu.Lock()
+	if pending, ok := c.inflight[key]; ok {
+		c.inflightMu.Unlock()
+		<-pending.done
+		return pending.data, pending.err
+	}
+	current := &call{done: make(chan struct{})}
+	c.inflight[key] = current
+	c.inflightMu.Unlock()
+
+	current.data, current.err = generate()
+	if current.err == nil {
+		if err := c.put(key, mediaID, modTime.UnixNano(), current.data); err != nil {
+			logger.Log().Sugar().Warnf("failed to cache thumbnail %s: %v", key, err)
+		}
+	}
+
+	c.inflightMu.Lock()
+	delete(c.inflight, key)
+	c.inflightMu.Unlock()
+	close(current.done)
+
+	return current.data, current.err
+}
+
+// Invalidate drops every cached thumbnail of the media items.
+func (c *Cache) Invalidate(mediaIDs ...string) {
+	ids := make(map[string]struct{}, len(mediaIDs))
+	for _, id := range mediaIDs {
+		ids[id] = struct{}{}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, elem := range c.entries {
+		if _, ok := ids[elem.Value.(*entry).mediaID]; ok {
+			c.removeLocked(elem)
+		}
+	}
+}
+
+// Listener returns a database.Listener that invalidates the thumbnails of
+// media once it is removed from the library.
+func (c *Cache) Listener() database.Listener {
+	return cacheListener{c}
+}
+
+type cacheListener struct {
+	cache *Cache
+}
+
+func (l cacheListener) MediaAdded(database.MediaItem) {}
+
+// MediaRemoved deletes the thumbnail files in the background, as listeners
+// must not block.
+func (l cacheListener) MediaRemoved(items []database.MediaItem) {
+	ids := make([]string, len(items))
+	for i, item := range items {
+		ids[i] = item.ID
+	}
+	go l.cache.Invalidate(ids...)
+}
+
+func (l cacheListener) SyncProgress(database.SyncProgress) {}
+
+func (c *Cache) path(key string) string {
+	return filepath.Join(c.dir, key)
+}
+
+func (c *Cache) get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	elem, ok := c.entries[key]
+	if ok {
+		c.lru.MoveToFront(elem)
+	}
+	c.mu.Unlock()
+	if !ok {
+		return nil, false
+	}
+
+	data, err := os.ReadFile(c.path(key))
+	if err != nil {
+		c.mu.Lock()
+		if _, ok := c.entries[key]; ok {
+			c.removeLocked(elem)
+		}
+		c.mu.Unlock()
+		return nil, false
+	}
+	// The file's mtime doubles as its last use when the cache is reloaded.
+	now := time.Now()
+	os.Chtimes(c.path(key), now, now)
+	return data, true
+}
+
+func (c *Cache) put(key string, mediaID string, modTime int64, data []byte) error {
+	tmp := c.path(key) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, c.path(key)); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Thumbnails of an older version of the source are never used again.
+	for _, elem := range c.entries {
+		if e := elem.Value.(*entry); e.mediaID == mediaID && e.modTime != modTime {
+			c.removeLocked(elem)
+		}
+	}
+	if elem, ok := c.entries[key]; ok {
+		c.size -= elem.Value.(*entry).size
+		c.lru.Remove(elem)
+		delete(c.entries, key)
+	}
+
+	c.addLocked(&entry{key: key, mediaID: mediaID, modTime: modTime, size: int64(len(data))})
+	c.evictLocked()
+	return nil
+}
+
+// load indexes the files already in the cache directory, treating the most
+// recently modified ones as the most recently used.
+func (c *Cache) load() error {
+	dirEntries, err := os.ReadDir(c.dir)
+	if err != nil {
+		return err
+	}
+
+	type found struct {
+		entry *entry
+		used  time.Time
+	}
+	var files []found
+	for _, d := range dirEntries {
+		key := d.Name()
+		if d.IsDir() {
+			continue
+		}
+		// Leftovers of interrupted writes.
+		if strings.HasSuffix(key, ".tmp") {
+			os.Remove(filepath.Join(c.dir, key))
+			continue
+		}
+		mediaID, modTime, ok := parseKey(key)
+		info, err := d.Info()
+		if !ok || err != nil {
+			continue
+		}
+		files = append(files, found{
+			entry: &entry{key: key, mediaID: mediaID, modTime: modTime, size: info.Size()},
+			used:  info.ModTime(),
+		})
+	}
+
+	sort.Slice(files, func(i, j int) bool { return files[i].used.Before(files[j].used) })
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, f := range files {
+		c.addLocked(f.entry)
+	}
+	c.evictLocked()
+	logger.Log().Sugar().Infof("Thumbnail cache loaded %d entries (%d bytes)", len(c.entries), c.size)
+	return nil
+}
+
+// parseKey extracts the media ID and source modification time from a key
+// produced by Key.
+func parseKey(key string) (string, int64, bool) {
+	key = strings.TrimSuffix(key, filepath.Ext(key))
+	parts := strings.Split(key, "-")
+	if len(parts) < 2 {
+		return "", 0, false
+	}
+	modTime, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return "", 0, false
+	}
+	return parts[0], modTime, true
+}
+
+func (c *Cache) addLocked(e *entry) {
+	c.entries[e.key] = c.lru.PushFront(e)
+	c.size += e.size
+}
+
+func (c *Cache) removeLocked(elem *list.Element) {
+	e := elem.Value.(*entry)
+	c.lru.Remove(elem)
+	delete(c.entries, e.key)
+	c.size -= e.size
+	if err := os.Remove(c.path(e.key)); err != nil && !os.IsNotExist(err) {
+		logger.Log().Sugar().Warnf("failed to remove thumbnail %s: %v", e.key, err)
+	}
+}
+
+// evictLocked drops least recently used entries until the cache fits its
+// size limit. A limit of zero or less disables eviction.
+func (c *Cache) evictLocked() {
+	if c.maxBytes <= 0 {
+		return
+	}
+	for c.size > c.maxBytes && c.lru.Len() > 0 {
+		c.removeLocked(c.lru.Back())
+	}
+}
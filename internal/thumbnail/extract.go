@@ -0,0 +1,147 @@
+package thumbnail
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+)
+
+const (
+	FormatJPEG = "jpeg"
+	FormatPNG  = "png"
+	FormatWebP = "webp"
+
+	// defaultOffset is where thumbnails are taken when no percentage is
+	// requested, in seconds.
+	defaultOffset = 4.0
+)
+
+// Options selects the thumbnail variant to produce. Zero Width or Height
+// keeps the aspect ratio, zero for both keeps the source resolution. A
+// negative Percent takes the frame at the default offset instead of a
+// percentage of the duration.
+type Options struct {
+	Width   int
+	Height  int
+	Percent float64
+	Format  string
+}
+
+// DefaultOptions is the variant pre-generated in the background and served
+// when a request doesn't ask for anything else.
+func DefaultOptions() Options {
+	return Options{Percent: -1, Format: FormatJPEG}
+}
+
+// IsDefault reports whether opts describe the default variant.
+func (opts Options) IsDefault() bool {
+	return opts.variant() == "" && opts.Format == FormatJPEG
+}
+
+// ContentType returns the MIME type of the thumbnail format.
+func (opts Options) ContentType() string {
+	switch opts.Format {
+	case FormatPNG:
+		return "image/png"
+	case FormatWebP:
+		return "image/webp"
+	default:
+		return "image/jpeg"
+	}
+}
+
+// variant encodes the non-default size and offset settings for cache keys.
+func (opts Options) variant() string {
+	var b strings.Builder
+	if opts.Width > 0 {
+		b.WriteString("w" + strconv.Itoa(opts.Width))
+	}
+	if opts.Height > 0 {
+		b.WriteString("h" + strconv.Itoa(opts.Height))
+	}
+	if opts.Percent >= 0 {
+		b.WriteString("p" + strconv.FormatFloat(opts.Percent, 'f', -1, 64))
+	}
+	return b.String()
+}
+
+func (opts Options) extension() string {
+	switch opts.Format {
+	case FormatPNG:
+		return ".png"
+	case FormatWebP:
+		return ".webp"
+	default:
+		return ".jpg"
+	}
+}
+
+// offset returns the seek position, in seconds, for a media of the given
+// duration. Positions past the end fall back to the first frame; an unknown
+// (zero) duration keeps the default offset.
+func (opts Options) offset(duration float64) float64 {
+	offset := defaultOffset
+	if opts.Percent >= 0 && duration > 0 {
+		offset = duration * opts.Percent / 100
+	}
+	if duration > 0 && offset >= duration {
+		return 0
+	}
+	return offset
+}
+
+// Extract grabs a single frame of the video as described by opts. If seeking
+// yields no frame (the offset is past the end) the first frame is used.
+func Extract(videoPath string, duration float64, opts Options) ([]byte, error) {
+	offset := opts.offset(duration)
+	data, err := extractAt(videoPath, offset, opts)
+	if err == nil && len(data) == 0 && offset > 0 {
+		data, err = extractAt(videoPath, 0, opts)
+	}
+	if err == nil && len(data) == 0 {
+		return nil, fmt.Errorf("ffmpeg produced no frame")
+	}
+	return data, err
+}
+
+func extractAt(videoPath string, offset float64, opts Options) ([]byte, error) {
+	buf := bytes.NewBuffer(nil)
+
+	output := ffmpeg.KwArgs{"vframes": "1"}
+	switch opts.Format {
+	case FormatPNG:
+		output["format"] = "image2pipe"
+		output["vcodec"] = "png"
+	case FormatWebP:
+		output["format"] = "webp"
+		output["vcodec"] = "libwebp"
+	default:
+		output["format"] = "mjpeg"
+	}
+	if opts.Width > 0 || opts.Height > 0 {
+		output["vf"] = fmt.Sprintf("scale=%d:%d", scaleDimension(opts.Width), scaleDimension(opts.Height))
+	}
+
+	err := ffmpeg.Input(videoPath, ffmpeg.KwArgs{"ss": strconv.FormatFloat(offset, 'f', 3, 64)}).
+		Output("pipe:", output).
+		WithOutput(buf, os.Stderr).
+		Run()
+	if err != nil {
+		return nil, fmt.Errorf("ffmpeg-go error: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// scaleDimension maps an unset dimension to -2, which tells ffmpeg to keep
+// the aspect ratio with an even size.
+func scaleDimension(size int) int {
+	if size <= 0 {
+		return -2
+	}
+	return size
+}
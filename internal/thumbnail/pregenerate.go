@@ -0,0 +1,180 @@
+package thumbnail
+
+import (
+	database "media_server/internal/db"
+	"media_server/internal/logger"
+	"os"
+	"sync"
+)
+
+// DefaultWorkers is the number of thumbnails generated concurrently in the
+// background.
+const DefaultWorkers = 4
+
+// Progress describes the current (or last) pre-generation run.
+type Progress struct {
+	Running bool `json:"running"`
+	Total   int  `json:"total"`
+	Done    int  `json:"done"`
+	Failed  int  `json:"failed"`
+}
+
+// Pregenerator fills the thumbnail cache in the background for every media
+// item that doesn't have a thumbnail yet, recording failures per item.
+type Pregenerator struct {
+	db      *database.DBObject
+	cache   *Cache
+	workers int
+
+	mu       sync.Mutex
+	progress Progress
+
+	trigger chan struct{}
+	done    chan struct{}
+	wg      sync.WaitGroup
+}
+
+func NewPregenerator(db *database.DBObject, cache *Cache, workers int) *Pregenerator {
+	if workers <= 0 {
+		workers = DefaultWorkers
+	}
+	return &Pregenerator{
+		db:      db,
+		cache:   cache,
+		workers: workers,
+		trigger: make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+}
+
+// Start runs the pregenerator until Close is called. Runs happen whenever
+// Trigger is called.
+func (p *Pregenerator) Start() {
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		for {
+			select {
+			case <-p.done:
+				return
+			case <-p.trigger:
+				p.run()
+			}
+		}
+	}()
+}
+
+// Trigger schedules a run. Calls made while a run is in progress collapse
+// into a single follow-up run.
+func (p *Pregenerator) Trigger() {
+	select {
+	case p.trigger <- struct{}{}:
+	default:
+	}
+}
+
+// Close stops the pregenerator once the thumbnails being generated finish.
+func (p *Pregenerator) Close() {
+	close(p.done)
+	p.wg.Wait()
+}
+
+// Progress returns a snapshot of the current run.
+func (p *Pregenerator) Progress() Progress {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.progress
+}
+
+func (p *Pregenerator) run() {
+	items, err := p.db.PendingThumbnails()
+	if err != nil {
+		logger.Log().Sugar().Errorf("failed to list pending thumbnails: %v", err)
+		return
+	}
+	if len(items) == 0 {
+		return
+	}
+
+	p.mu.Lock()
+	p.progress = Progress{Running: true, Total: len(items)}
+	p.mu.Unlock()
+	logger.Log().Sugar().Infof("Generating %d thumbnails with %d workers", len(items), p.workers)
+
+	jobs := make(chan database.MediaItem)
+	var wg sync.WaitGroup
+	for i := 0; i < p.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for item := range jobs {
+				p.generate(item)
+			}
+		}()
+	}
+
+send:
+	for _, item := range items {
+		select {
+		case <-p.done:
+			break send
+		case jobs <- item:
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	p.mu.Lock()
+	p.progress.Running = false
+	progress := p.progress
+	p.mu.Unlock()
+	logger.Log().Sugar().Infof("Thumbnail generation finished: %d/%d done, %d failed", progress.Done, progress.Total, progress.Failed)
+}
+
+func (p *Pregenerator) generate(item database.MediaItem) {
+	_, err := Get(p.db, p.cache, item, DefaultOptions())
+
+	p.mu.Lock()
+	p.progress.Done++
+	if err != nil {
+		p.progress.Failed++
+	}
+	done, total := p.progress.Done, p.progress.Total
+	p.mu.Unlock()
+
+	if err != nil {
+		logger.Log().Sugar().Warnf("Thumbnail %d/%d for %s failed: %v", done, total, item.ID, err)
+		return
+	}
+	logger.Log().Sugar().Debugf("Thumbnail %d/%d for %s generated", done, total, item.ID)
+}
+
+// Get returns the thumbnail variant of item described by opts, producing and
+// caching it on a miss. The outcome for the default variant is recorded on
+// the item; other variants failing (e.g. an ffmpeg without WebP support)
+// says nothing about the file itself.
+func Get(db *database.DBObject, cache *Cache, item database.MediaItem, opts Options) ([]byte, error) {
+	fi, err := os.Stat(item.Path)
+	if err == nil {
+		var data []byte
+		data, err = cache.GetOrCreate(item.ID, fi.ModTime(), opts, func() ([]byte, error) {
+			return Extract(item.Path, item.Duration, opts)
+		})
+		if err == nil {
+			if opts.IsDefault() && item.ThumbnailStatus != database.ThumbnailReady {
+				if err := db.SetThumbnailStatus(item.ID, database.ThumbnailReady, ""); err != nil {
+					logger.Log().Sugar().Warnf("failed to record thumbnail status for %s: %v", item.ID, err)
+				}
+			}
+			return data, nil
+		}
+	}
+
+	if !opts.IsDefault() {
+		return nil, err
+	}
+	if err := db.SetThumbnailStatus(item.ID, database.ThumbnailFailed, err.Error()); err != nil {
+		logger.Log().Sugar().Warnf("failed to record thumbnail status for %s: %v", item.ID, err)
+	}
+	return nil, err
+}
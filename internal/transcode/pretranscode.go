@@ -0,0 +1,164 @@
+package transcode
+
+import (
+	"fmt"
+	database "media_server/internal/db"
+	"media_server/internal/logger"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+)
+
+// DefaultPretranscodeInterval is how often the Pretranscoder looks for items
+// that still need a rendition.
+const DefaultPretranscodeInterval = time.Minute
+
+// Pretranscoder produces MP4 renditions ahead of time for media browsers
+// can't play directly. It only works while enabled returns true, i.e. while
+// on-demand streaming is switched off.
+type Pretranscoder struct {
+	db       *database.DBObject
+	dir      string
+	interval time.Duration
+	enabled  func() bool
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+func NewPretranscoder(db *database.DBObject, dir string, interval time.Duration, enabled func() bool) (*Pretranscoder, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	if interval <= 0 {
+		interval = DefaultPretranscodeInterval
+	}
+	return &Pretranscoder{
+		db:       db,
+		dir:      dir,
+		interval: interval,
+		enabled:  enabled,
+		done:     make(chan struct{}),
+	}, nil
+}
+
+// Start runs the background job until Close is called.
+func (p *Pretranscoder) Start() {
+	p.wg.Add(1)
+	go p.loop()
+}
+
+// Close stops the job, aborting the rendition currently being produced.
+func (p *Pretranscoder) Close() {
+	close(p.done)
+	p.wg.Wait()
+}
+
+func (p *Pretranscoder) loop() {
+	defer p.wg.Done()
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		p.runPending()
+		select {
+		case <-p.done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// pendingBatch is how many pending items runPending fetches at a time.
+const pendingBatch = 16
+
+// runPending renders items one at a time until none are left, the job is
+// disabled or it is closed.
+func (p *Pretranscoder) runPending() {
+	for p.enabled() {
+		items, err := p.db.PendingRenditions(pendingBatch)
+		if err != nil {
+			logger.Log().Sugar().Errorf("failed to list pending renditions: %v", err)
+			return
+		}
+
+		rendered := false
+		for _, item := range items {
+			// Only video and audio get renditions; anything else is left
+			// alone rather than handed to ffmpeg and recorded as failed.
+			if !item.Playable() {
+				logger.Log().Sugar().Warnf("skipping rendition for %s: %q media is not transcoded", item.ID, item.Type)
+				continue
+			}
+			if !p.enabled() || !p.renderItem(item) {
+				return
+			}
+			rendered = true
+		}
+		if !rendered {
+			return
+		}
+	}
+}
+
+// renderItem produces and records the rendition for item. It returns false
+// when the job should stop.
+func (p *Pretranscoder) renderItem(item database.MediaItem) bool {
+	path := filepath.Join(p.dir, item.ID+".mp4")
+	status := database.RenditionReady
+	if err := p.render(item, path); err != nil {
+		select {
+		case <-p.done:
+			return false
+		default:
+		}
+		logger.Log().Sugar().Errorf("failed to pre-transcode %s: %v", item.ID, err)
+		status = database.RenditionFailed
+		path = ""
+	} else {
+		logger.Log().Sugar().Infof("Rendition for %s ready", item.ID)
+	}
+
+	if err := p.db.SetRendition(item.ID, status, path); err != nil {
+		logger.Log().Sugar().Errorf("failed to record rendition for %s: %v", item.ID, err)
+		return false
+	}
+	return true
+}
+
+// render transcodes item into path, writing to a temporary file first so a
+// half-finished rendition is never served.
+func (p *Pretranscoder) render(item database.MediaItem, path string) error {
+	tmp := path + ".tmp"
+	output := mp4Args(item.Remuxable())
+	output["movflags"] = "+faststart"
+
+	cmd := ffmpeg.Input(item.Path).
+		Output(tmp, output).
+		OverWriteOutput().
+		Compile()
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start ffmpeg: %w", err)
+	}
+	logger.Log().Sugar().Infof("Pre-transcoding %s", item.ID)
+
+	waitErr := make(chan error, 1)
+	go func() { waitErr <- cmd.Wait() }()
+
+	select {
+	case err := <-waitErr:
+		if err != nil {
+			os.Remove(tmp)
+			return err
+		}
+	case <-p.done:
+		cmd.Process.Kill()
+		<-waitErr
+		os.Remove(tmp)
+		return fmt.Errorf("pre-transcode of %s aborted", item.ID)
+	}
+	return os.Rename(tmp, path)
+}
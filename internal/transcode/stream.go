@@ -0,0 +1,63 @@
+package transcode
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+)
+
+// mp4Args returns the ffmpeg output options producing browser-friendly MP4,
+// copying the streams when remux is set and transcoding them otherwise.
+func mp4Args(remux bool) ffmpeg.KwArgs {
+	args := ffmpeg.KwArgs{
+		"map": []string{"0:v:0?", "0:a:0?"},
+		"f":   "mp4",
+	}
+	if remux {
+		args["c"] = "copy"
+		return args
+	}
+	args["c:v"] = "libx264"
+	args["preset"] = "veryfast"
+	args["pix_fmt"] = "yuv420p"
+	args["c:a"] = "aac"
+	args["ac"] = "2"
+	return args
+}
+
+// StreamMP4 writes source to w as fragmented MP4 starting at start seconds,
+// so it can be played while it is being produced. It returns once ffmpeg
+// finishes or ctx is cancelled.
+func StreamMP4(ctx context.Context, w io.Writer, source string, start float64, remux bool) error {
+	input := ffmpeg.KwArgs{}
+	if start > 0 {
+		input["ss"] = strconv.FormatFloat(start, 'f', 3, 64)
+	}
+
+	output := mp4Args(remux)
+	output["movflags"] = "frag_keyframe+empty_moov+default_base_moof"
+
+	cmd := ffmpeg.Input(source, input).
+		Output("pipe:", output).
+		Compile()
+	cmd.Stdout = w
+
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start ffmpeg: %w", err)
+	}
+
+	waitErr := make(chan error, 1)
+	go func() { waitErr <- cmd.Wait() }()
+
+	select {
+	case err := <-waitErr:
+		return err
+	case <-ctx.Done():
+		cmd.Process.Kill()
+		<-waitErr
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,349 @@
+package transcode
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"media_server/internal/logger"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+)
+
+const (
+	// SegmentDuration is the target length of every HLS segment, in seconds.
+	SegmentDuration = 6
+
+	// DefaultIdleTimeout is how long a session may go without a request
+	// before its ffmpeg process is stopped and its segments removed.
+	DefaultIdleTimeout = 2 * time.Minute
+
+	// segmentWait bounds how long a request waits for ffmpeg to produce a
+	// segment.
+	segmentWait = 30 * time.Second
+
+	// seekThreshold is how many segments ahead of the encoder a request may
+	// be before the encoder is restarted at the requested position instead
+	// of waiting for it to get there.
+	seekThreshold = 3
+)
+
+var ErrSegmentOutOfRange = errors.New("segment out of range")
+
+// Manager owns the on-demand HLS transcode sessions, one per media item.
+type Manager struct {
+	dir         string
+	idleTimeout time.Duration
+
+	mu       sync.Mutex
+	sessions map[string]*session
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+type session struct {
+	mediaID string
+	source  string
+	dir     string
+
+	mu           sync.Mutex
+	cmd          *exec.Cmd
+	exited       chan struct{}
+	startSegment int
+	lastAccess   time.Time
+}
+
+// NewManager creates a Manager that writes its segments below dir. Anything
+// left in dir by a previous run is removed.
+func NewManager(dir string, idleTimeout time.Duration) (*Manager, error) {
+	if idleTimeout <= 0 {
+		idleTimeout = DefaultIdleTimeout
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	m := &Manager{
+		dir:         dir,
+		idleTimeout: idleTimeout,
+		sessions:    make(map[string]*session),
+		done:        make(chan struct{}),
+	}
+	m.wg.Add(1)
+	go m.janitor()
+	return m, nil
+}
+
+// Close stops every running transcode and removes the segment directory.
+func (m *Manager) Close() error {
+	close(m.done)
+	m.wg.Wait()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for id, s := range m.sessions {
+		s.stop()
+		delete(m.sessions, id)
+	}
+	return os.RemoveAll(m.dir)
+}
+
+// SegmentCount returns how many segments a media of the given duration
+// (in seconds) is split into.
+func SegmentCount(duration float64) int {
+	return int(math.Ceil(duration / SegmentDuration))
+}
+
+// MasterPlaylist renders the HLS master playlist pointing at the single
+// rendition served by MediaPlaylist.
+func MasterPlaylist(width int, height int, bitrate int64) string {
+	var b strings.Builder
+	b.WriteString("#EXTM3U\n")
+	b.WriteString("#EXT-X-VERSION:3\n")
+	if bitrate <= 0 {
+		bitrate = 5000000
+	}
+	b.WriteString(fmt.Sprintf("#EXT-X-STREAM-INF:BANDWIDTH=%d", bitrate))
+	if width > 0 && height > 0 {
+		b.WriteString(fmt.Sprintf(",RESOLUTION=%dx%d", width, height))
+	}
+	b.WriteString("\nindex.m3u8\n")
+	return b.String()
+}
+
+// MediaPlaylist renders a complete VOD playlist for a media of the given
+// duration. Every segment is listed up front so players can seek anywhere,
+// the segments themselves are produced on request.
+func MediaPlaylist(duration float64) string {
+	var b strings.Builder
+	b.WriteString("#EXTM3U\n")
+	b.WriteString("#EXT-X-VERSION:3\n")
+	b.WriteString(fmt.Sprintf("#EXT-X-TARGETDURATION:%d\n", SegmentDuration))
+	b.WriteString("#EXT-X-MEDIA-SEQUENCE:0\n")
+	b.WriteString("#EXT-X-PLAYLIST-TYPE:VOD\n")
+
+	count := SegmentCount(duration)
+	for i := 0; i < count; i++ {
+		length := math.Min(SegmentDuration, duration-float64(i*SegmentDuration))
+		b.WriteString(fmt.Sprintf("#EXTINF:%.3f,\n%d.ts\n", length, i))
+	}
+	b.WriteString("#EXT-X-ENDLIST\n")
+	return b.String()
+}
+
+// Segment returns the path of segment index for the media, starting or
+// restarting ffmpeg as needed and waiting until the segment is written.
+func (m *Manager) Segment(ctx context.Context, mediaID string, source string, duration float64, index int) (string, error) {
+	if index < 0 || index >= SegmentCount(duration) {
+		return "", ErrSegmentOutOfRange
+	}
+
+	s, err := m.session(mediaID, source)
+	if err != nil {
+		return "", err
+	}
+
+	path := s.segmentPath(index)
+	s.mu.Lock()
+	s.lastAccess = time.Now()
+	if _, err := os.Stat(path); err == nil {
+		s.mu.Unlock()
+		return path, nil
+	}
+	if !s.covers(index) {
+		if err := s.start(index); err != nil {
+			s.mu.Unlock()
+			return "", err
+		}
+	}
+	exited := s.exited
+	s.mu.Unlock()
+
+	return path, waitForSegment(ctx, path, exited)
+}
+
+func (m *Manager) session(mediaID string, source string) (*session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if s, ok := m.sessions[mediaID]; ok {
+		return s, nil
+	}
+
+	dir := filepath.Join(m.dir, mediaID)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	s := &session{
+		mediaID:    mediaID,
+		source:     source,
+		dir:        dir,
+		lastAccess: time.Now(),
+	}
+	m.sessions[mediaID] = s
+	return s, nil
+}
+
+// janitor stops sessions nobody has requested a segment from recently.
+func (m *Manager) janitor() {
+	defer m.wg.Done()
+	ticker := time.NewTicker(m.idleTimeout / 4)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.done:
+			return
+		case <-ticker.C:
+			m.mu.Lock()
+			for id, s := range m.sessions {
+				s.mu.Lock()
+				idle := time.Since(s.lastAccess) > m.idleTimeout
+				s.mu.Unlock()
+				if !idle {
+					continue
+				}
+				logger.Log().Sugar().Infof("Stopping idle transcode session for %s", id)
+				s.stop()
+				if err := os.RemoveAll(s.dir); err != nil {
+					logger.Log().Sugar().Warnf("failed to remove transcode dir %s: %v", s.dir, err)
+				}
+				delete(m.sessions, id)
+			}
+			m.mu.Unlock()
+		}
+	}
+}
+
+func (s *session) segmentPath(index int) string {
+	return filepath.Join(s.dir, fmt.Sprintf("segment%d.ts", index))
+}
+
+// covers reports whether the running encoder will reach index soon enough
+// that waiting beats restarting it. Callers must hold s.mu.
+func (s *session) covers(index int) bool {
+	if s.cmd == nil || isClosed(s.exited) || index < s.startSegment {
+		return false
+	}
+	produced := s.startSegment
+	for {
+		if _, err := os.Stat(s.segmentPath(produced)); err != nil {
+			break
+		}
+		produced++
+	}
+	return index <= produced+seekThreshold
+}
+
+// start (re)launches ffmpeg so that it begins encoding at segment index.
+// Callers must hold s.mu.
+func (s *session) start(index int) error {
+	s.stopLocked()
+
+	offset := fmt.Sprintf("%d", index*SegmentDuration)
+	cmd := ffmpeg.Input(s.source, ffmpeg.KwArgs{"ss": offset}).
+		Output(filepath.Join(s.dir, "stream.m3u8"), ffmpeg.KwArgs{
+			"map":                  []string{"0:v:0?", "0:a:0?"},
+			"c:v":                  "libx264",
+			"preset":               "veryfast",
+			"pix_fmt":              "yuv420p",
+			"force_key_frames":     fmt.Sprintf("expr:gte(t,n_forced*%d)", SegmentDuration),
+			"c:a":                  "aac",
+			"ac":                   "2",
+			"output_ts_offset":     offset,
+			"f":                    "hls",
+			"hls_time":             SegmentDuration,
+			"hls_list_size":        0,
+			"hls_flags":            "temp_file",
+			"start_number":         index,
+			"hls_segment_filename": filepath.Join(s.dir, "segment%d.ts"),
+		}).
+		OverWriteOutput().
+		Compile()
+
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start ffmpeg: %w", err)
+	}
+	logger.Log().Sugar().Infof("Started transcode of %s at segment %d", s.mediaID, index)
+
+	exited := make(chan struct{})
+	go func() {
+		if err := cmd.Wait(); err != nil {
+			logger.Log().Sugar().Debugf("transcode of %s exited: %v", s.mediaID, err)
+		}
+		close(exited)
+	}()
+
+	s.cmd = cmd
+	s.exited = exited
+	s.startSegment = index
+	return nil
+}
+
+func (s *session) stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stopLocked()
+}
+
+func (s *session) stopLocked() {
+	if s.cmd == nil {
+		return
+	}
+	if !isClosed(s.exited) {
+		if err := s.cmd.Process.Kill(); err != nil {
+			logger.Log().Sugar().Warnf("failed to stop transcode of %s: %v", s.mediaID, err)
+		}
+		<-s.exited
+	}
+	s.cmd = nil
+}
+
+// waitForSegment blocks until path exists, ffmpeg exits without writing it,
+// the request is cancelled or segmentWait elapses.
+func waitForSegment(ctx context.Context, path string, exited <-chan struct{}) error {
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	timeout := time.NewTimer(segmentWait)
+	defer timeout.Stop()
+
+	for {
+		if _, err := os.Stat(path); err == nil {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timeout.C:
+			return errors.New("timed out waiting for segment")
+		case <-exited:
+			if _, err := os.Stat(path); err == nil {
+				return nil
+			}
+			return errors.New("transcoder exited before producing segment")
+		case <-ticker.C:
+		}
+	}
+}
+
+func isClosed(ch <-chan struct{}) bool {
+	if ch == nil {
+		return true
+	}
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,150 @@
+package watcher
+
+import (
+	"media_server/internal/logger"
+	"media_server/internal/media"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// ConfigWatcher reloads the config store when its file is edited outside
+// the server. Edits that don't pass validation are rejected and the running
+// config is kept.
+type ConfigWatcher struct {
+	store    *media.ConfigStore
+	fsw      *fsnotify.Watcher
+	debounce time.Duration
+	onReject func(err error)
+
+	mu     sync.Mutex
+	timer  *time.Timer
+	closed bool
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewConfigWatcher returns a watcher for the file of store. onReject, if
+// not nil, is called with the reason whenever an edit is rejected.
+func NewConfigWatcher(store *media.ConfigStore, debounce time.Duration, onReject func(err error)) (*ConfigWatcher, error) {
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	if debounce <= 0 {
+		debounce = DefaultDebounce
+	}
+	return &ConfigWatcher{
+		store:    store,
+		fsw:      fsw,
+		debounce: debounce,
+		onReject: onReject,
+		done:     make(chan struct{}),
+	}, nil
+}
+
+// Start watches the directory of the config file, since editors often
+// replace the file rather than writing to it, and reloads it after changes.
+func (w *ConfigWatcher) Start() error {
+	if err := w.fsw.Add(filepath.Dir(w.store.Path())); err != nil {
+		return err
+	}
+	w.wg.Add(1)
+	go w.loop()
+	return nil
+}
+
+// Close stops the watcher and discards a pending reload.
+func (w *ConfigWatcher) Close() error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return nil
+	}
+	w.closed = true
+	if w.timer != nil {
+		w.timer.Stop()
+	}
+	w.mu.Unlock()
+
+	close(w.done)
+	err := w.fsw.Close()
+	w.wg.Wait()
+	return err
+}
+
+func (w *ConfigWatcher) loop() {
+	defer w.wg.Done()
+	path := filepath.Clean(w.store.Path())
+	for {
+		select {
+		case <-w.done:
+			return
+		case event, ok := <-w.fsw.Events:
+			if !ok {
+				return
+			}
+			if filepath.Clean(event.Name) != path || event.Op == fsnotify.Chmod {
+				continue
+			}
+			w.schedule()
+		case err, ok := <-w.fsw.Errors:
+			if !ok {
+				return
+			}
+			logger.Log().Sugar().Errorf("config watcher error: %v", err)
+		}
+	}
+}
+
+// schedule (re)starts the debounce timer so a burst of writes results in a
+// single reload.
+func (w *ConfigWatcher) schedule() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return
+	}
+	if w.timer != nil {
+		w.timer.Reset(w.debounce)
+		return
+	}
+	w.timer = time.AfterFunc(w.debounce, w.reload)
+}
+
+func (w *ConfigWatcher) reload() {
+	w.mu.Lock()
+	closed := w.closed
+	w.mu.Unlock()
+	if closed {
+		return
+	}
+
+	path := w.store.Path()
+	old := w.store.Get()
+	changed, err := w.store.Reload()
+	if err != nil {
+		logger.Log().Sugar().Warnf("Rejected changes to %s, keeping the running config: %v", path, err)
+		if w.onReject != nil {
+			w.onReject(err)
+		}
+		return
+	}
+	if !changed {
+		return
+	}
+
+	diff := media.Diff(old, w.store.Get())
+	logger.Log().Sugar().Infof("Reloaded %s: %d media directories added, %d removed, extensions changed: %t, on_demand changed: %t",
+		path, len(diff.AddedDirs), len(diff.RemovedDirs), diff.ExtensionsChanged, diff.StreamModeChanged)
+	if diff.ThumbnailsChanged {
+		logger.Log().Sugar().Warnf("Thumbnail cache settings in %s take effect after a restart", path)
+	}
+	if diff.ServerChanged {
+		logger.Log().Sugar().Warnf("Server settings in %s take effect after a restart", path)
+	}
+}
@@ -0,0 +1,312 @@
+package watcher
+
+import (
+	"errors"
+	database "media_server/internal/db"
+	"media_server/internal/logger"
+	"media_server/internal/media"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// DefaultDebounce is how long a path has to stay quiet before its changes
+// are applied to the database.
+const DefaultDebounce = 2 * time.Second
+
+// Watcher keeps the media table in sync with the configured media
+// directories by listening for filesystem (inotify) events.
+type Watcher struct {
+	config   *media.Config
+	db       *database.DBObject
+	fsw      *fsnotify.Watcher
+	debounce time.Duration
+
+	// mu guards config, dirChanges as well as the debounce state.
+	mu         sync.Mutex
+	pending    map[string]*time.Timer
+	dirChanges []dirChange
+	closed     bool
+
+	// wake tells the event loop that dirChanges has work.
+	wake chan struct{}
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+func New(config *media.Config, db *database.DBObject, debounce time.Duration) (*Watcher, error) {
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	if debounce <= 0 {
+		debounce = DefaultDebounce
+	}
+	return &Watcher{
+		config:   config,
+		db:       db,
+		fsw:      fsw,
+		debounce: debounce,
+		pending:  make(map[string]*time.Timer),
+		wake:     make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}, nil
+}
+
+// Start registers watches for every media directory (and their
+// subdirectories) and begins processing events in the background.
+func (w *Watcher) Start() error {
+	config := w.currentConfig()
+	for _, dir := range config.MediaDirs {
+		if err := w.addTree(dir); err != nil {
+			logger.Log().Sugar().Warnf("failed to watch %s: %v", dir, err)
+		}
+	}
+
+	w.wg.Add(1)
+	go w.loop()
+	logger.Log().Sugar().Infof("Watching %d media directories", len(config.MediaDirs))
+	return nil
+}
+
+// dirChange lists the media directories a new config adds and drops.
+type dirChange struct {
+	config  *media.Config
+	added   []string
+	removed []string
+}
+
+// ConfigChanged queues watching the media directories config adds and no
+// longer watching the ones it drops; the event loop walks them, so the
+// config store isn't held up. Subscribe it to the config store. Media
+// already inside new directories is not indexed; that is left to a scan.
+func (w *Watcher) ConfigChanged(config *media.Config, version uint64) {
+	w.mu.Lock()
+	old := w.config
+	w.config = config
+	change := dirChange{config: config}
+	for _, dir := range config.MediaDirs {
+		if old.RootFor(dir) == "" {
+			change.added = append(change.added, dir)
+		}
+	}
+	for _, dir := range old.MediaDirs {
+		if config.RootFor(dir) == "" {
+			change.removed = append(change.removed, dir)
+		}
+	}
+	if len(change.added) > 0 || len(change.removed) > 0 {
+		w.dirChanges = append(w.dirChanges, change)
+	}
+	w.mu.Unlock()
+
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+// applyDirChanges adds and removes the watches queued by ConfigChanged.
+func (w *Watcher) applyDirChanges() {
+	w.mu.Lock()
+	changes := w.dirChanges
+	w.dirChanges = nil
+	w.mu.Unlock()
+
+	for _, change := range changes {
+		for _, dir := range change.added {
+			if err := w.addTree(dir); err != nil {
+				logger.Log().Sugar().Warnf("failed to watch %s: %v", dir, err)
+			}
+		}
+		for _, dir := range change.removed {
+			w.removeTree(change.config, dir)
+		}
+	}
+}
+
+// removeTree stops watching dir and its subdirectories, except those still
+// covered by a media directory of config.
+func (w *Watcher) removeTree(config *media.Config, dir string) {
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || !info.IsDir() {
+			return nil
+		}
+		if config.RootFor(path) == "" {
+			// Removing a watch that no longer exists is harmless.
+			_ = w.fsw.Remove(path)
+		}
+		return nil
+	})
+}
+
+func (w *Watcher) currentConfig() *media.Config {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.config
+}
+
+// Close stops the watcher and discards any changes still being debounced.
+func (w *Watcher) Close() error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return nil
+	}
+	w.closed = true
+	for path, timer := range w.pending {
+		timer.Stop()
+		delete(w.pending, path)
+	}
+	w.mu.Unlock()
+
+	close(w.done)
+	err := w.fsw.Close()
+	w.wg.Wait()
+	return err
+}
+
+func (w *Watcher) addTree(root string) error {
+	return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if info.IsDir() {
+			if err := w.fsw.Add(path); err != nil {
+				logger.Log().Sugar().Warnf("failed to watch %s: %v", path, err)
+			}
+		}
+		return nil
+	})
+}
+
+func (w *Watcher) loop() {
+	defer w.wg.Done()
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-w.wake:
+			w.applyDirChanges()
+		case event, ok := <-w.fsw.Events:
+			if !ok {
+				return
+			}
+			if event.Op == fsnotify.Chmod {
+				continue
+			}
+			w.schedule(event.Name)
+		case err, ok := <-w.fsw.Errors:
+			if !ok {
+				return
+			}
+			logger.Log().Sugar().Errorf("watcher error: %v", err)
+		}
+	}
+}
+
+// schedule (re)starts the debounce timer for path so a burst of writes
+// results in a single database update.
+func (w *Watcher) schedule(path string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return
+	}
+	if timer, ok := w.pending[path]; ok {
+		timer.Reset(w.debounce)
+		return
+	}
+	w.pending[path] = time.AfterFunc(w.debounce, func() {
+		w.mu.Lock()
+		delete(w.pending, path)
+		closed := w.closed
+		w.mu.Unlock()
+
+		if !closed {
+			w.apply(path)
+		}
+	})
+}
+
+// apply brings the database in line with the current state of path.
+func (w *Watcher) apply(path string) {
+	info, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		w.remove(path)
+		return
+	}
+	if err != nil {
+		logger.Log().Sugar().Warnf("failed to stat %s: %v", path, err)
+		return
+	}
+
+	// Events can still arrive for a media directory that was just removed.
+	config := w.currentConfig()
+	if config.RootFor(path) == "" {
+		return
+	}
+
+	if info.IsDir() {
+		w.addDir(config, path)
+		return
+	}
+
+	file, ok := config.NewMediaFile(path, info)
+	if !ok {
+		return
+	}
+	w.upsert(file)
+}
+
+// upsert stores a new or changed file and refreshes its technical metadata.
+func (w *Watcher) upsert(file media.MediaFile) {
+	item := database.MediaItemFromFile(file)
+	if err := w.db.UpsertMediaItem(&item); err != nil {
+		logger.Log().Sugar().Errorf("failed to upsert media %s: %v", file.Path, err)
+		return
+	}
+	if err := w.db.ProbeMediaItem(file.ID, file.Path); err != nil {
+		logger.Log().Sugar().Warnf("failed to probe media %s: %v", file.Path, err)
+	}
+}
+
+// addDir watches a newly created directory tree and indexes the media
+// already inside it, since files can land before the watch is registered.
+func (w *Watcher) addDir(config *media.Config, dir string) {
+	if err := w.addTree(dir); err != nil {
+		logger.Log().Sugar().Warnf("failed to watch %s: %v", dir, err)
+	}
+
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		file, ok := config.NewMediaFile(path, info)
+		if !ok {
+			return nil
+		}
+		w.upsert(file)
+		return nil
+	})
+}
+
+// remove drops the media stored at path. The path may have been a file or a
+// whole directory, so both are cleared.
+func (w *Watcher) remove(path string) {
+	// Removing a watch that no longer exists is harmless.
+	_ = w.fsw.Remove(path)
+
+	removed, err := w.db.DeleteMediaUnder(path)
+	if err != nil {
+		logger.Log().Sugar().Errorf("failed to delete media under %s: %v", path, err)
+		return
+	}
+	if removed > 0 {
+		logger.Log().Sugar().Infof("Removed %d media items under %s", removed, path)
+	}
+}
@@ -11,19 +11,33 @@
 
 // @host      localhost:8000
 // @BasePath  /
+
+// @securityDefinitions.apikey  BearerAuth
+// @in                          header
+// @name                        Authorization
+// @description                 Session token from /auth/login, sent as "Bearer <token>".
 package main
 
 import (
 	"bufio"
 	"context"
-	"fmt"
+	"errors"
+	"flag"
+	"media_server/docs" // docs generated by swag init
 	database "media_server/internal/db"
 	handlers "media_server/internal/handlers"
+	"media_server/internal/hub"
+	"media_server/internal/library"
 	"media_server/internal/logger"
 	"media_server/internal/media"
-	"net"
+	"media_server/internal/share"
+	"media_server/internal/thumbnail"
+	"media_server/internal/transcode"
+	"media_server/internal/watcher"
 	"net/http"
+	"net/url"
 	"os"
+	"path/filepath"
 	"sync"
 	"time"
 
@@ -32,8 +46,6 @@ import (
 	"github.com/gorilla/websocket"
 	"go.uber.org/zap"
 
-	_ "media_server/docs" // docs generated by swag init
-
 	httpSwagger "github.com/swaggo/http-swagger"
 )
 
@@ -46,13 +58,31 @@ func main() {
 	wg.Add(2)
 	logger.InitLogger(true)
 	defer logger.Log().Sync()
-	media.SetConfigPath("config.json")
 
-	config, err := media.LoadConfig()
+	// Server settings come from the flags, then MEDIA_SERVER_* environment
+	// variables, then config.json, then the defaults.
+	overrides, err := media.ParseOverrides(os.Args[0], os.Args[1:], os.LookupEnv)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	} else if err != nil {
+		logger.Log().Sugar().Errorf("invalid arguments: %v", err)
+		return
+	}
+	configStore, err := media.NewConfigStore(overrides.ConfigPath())
+	if err != nil {
+		logger.Log().Sugar().Errorf("failed to load config: %v", err)
+		return
+	}
+	config := configStore.Get()
+	settings, err := config.ServerSettings(overrides)
 	if err != nil {
-		logger.Log().Sugar().Error("failed to load config")
+		// Exit with a failure status, so scripts and service managers
+		// notice, instead of failing later with a bind error.
+		logger.Log().Sugar().Errorf("invalid server settings: %v", err)
+		logger.Log().Sync()
+		os.Exit(2)
 	}
-	logger.Log().Sugar().Info("loaded config sucesfully")
+	logger.Log().Sugar().Infof("loaded config sucesfully from %s", configStore.Path())
 
 	media_files, err := config.ScanMediaDirs()
 	if err != nil {
@@ -60,51 +90,136 @@ func main() {
 		return
 	}
 
-	dbObj := database.InitDataBase("media.db")
+	dbObj := database.InitDataBase(settings.DBPath)
 
 	if dbObj.Err != nil {
 		logger.Log().Sugar().Errorf("failed to create db: %v \n", err)
 		return
 	}
 
+	thumbDir, thumbMaxBytes := config.ThumbnailCache()
+	thumbnails, err := thumbnail.NewCache(thumbDir, thumbMaxBytes)
+	if err != nil {
+		logger.Log().Sugar().Errorf("failed to open thumbnail cache: %v", err)
+		return
+	}
+
+	// Library changes are pushed to websocket clients through the hub, and
+	// the thumbnails of removed media are dropped from the cache.
+	wsHub := hub.New()
+	defer wsHub.Close()
+	dbObj.Listener = database.Listeners{wsHub, thumbnails.Listener()}
+	configStore.Subscribe(func(cfg *media.Config, version uint64) {
+		wsHub.ConfigUpdated(cfg)
+	})
+
+	// The password is kept out of the log, stdout and stderr alike, since
+	// those are often captured together; it only goes to a private file.
+	passwordFile := settings.AdminPasswordPath()
+	if created, err := dbObj.EnsureAdmin(func(password string) error {
+		return writePrivateFile(passwordFile, password+"\n")
+	}); err != nil {
+		logger.Log().Sugar().Errorf("failed to create admin account: %v", err)
+		return
+	} else if created {
+		logger.Log().Sugar().Warnf("Created account %q, its password is in %s; log in, change it and delete the file", database.BootstrapAdmin, passwordFile)
+	}
+	if purged, err := dbObj.PurgeExpiredSessions(); err != nil {
+		logger.Log().Sugar().Warnf("failed to purge expired sessions: %v", err)
+	} else if purged > 0 {
+		logger.Log().Sugar().Infof("Purged %d expired sessions", purged)
+	}
+
 	logger.Log().Info("Syncing database")
-	if err := dbObj.SyncDatabase(&media_files); err != nil {
+	report, err := dbObj.SyncDatabase(&media_files)
+	if err != nil {
 		logger.Log().Sugar().Panicf("failed to sync db: %v", err)
 		return
 	}
+	logger.Log().Sugar().Infof("Library synced: %d added, %d removed, %d unchanged", report.Added, report.Removed, report.Unchanged)
 
-	addrs, err := net.InterfaceAddrs()
+	mediaWatcher, err := watcher.New(config, &dbObj, watcher.DefaultDebounce)
 	if err != nil {
-		logger.Log().Sugar().Errorf("failed to get network interfaces: %v", err)
+		logger.Log().Sugar().Errorf("failed to create media watcher: %v", err)
 		return
 	}
-	var allowedOrigin string
-	var allowedOrigin2 string
-	for _, addr := range addrs {
-		if ipNet, ok := addr.(*net.IPNet); ok && !ipNet.IP.IsLoopback() {
-			if ip := ipNet.IP.To4(); ip != nil {
-				allowedOrigin = fmt.Sprintf("http://%s:4173", ip.String())
-				allowedOrigin2 = fmt.Sprintf("http://%s:5173", ip.String())
-				break
-			}
-		}
-	}
-	if allowedOrigin == "" {
-		panic("no local IP found")
+	if err := mediaWatcher.Start(); err != nil {
+		logger.Log().Sugar().Errorf("failed to start media watcher: %v", err)
+		return
 	}
+	defer mediaWatcher.Close()
+	configStore.Subscribe(mediaWatcher.ConfigChanged)
+
 	router := chi.NewRouter()
 	srv := &http.Server{
-		Addr:    ":8000",
+		Addr:    settings.HTTPAddr(),
 		Handler: router, // your chi router
 	}
-	handle := handlers.Handler{DB: &dbObj, Logger: logger.Log()}
+	transcoder, err := transcode.NewManager(filepath.Join(os.TempDir(), "media_server_hls"), transcode.DefaultIdleTimeout)
+	if err != nil {
+		logger.Log().Sugar().Errorf("failed to create transcoder: %v", err)
+		return
+	}
+	defer transcoder.Close()
+
+	pretranscoder, err := transcode.NewPretranscoder(&dbObj, "renditions", transcode.DefaultPretranscodeInterval, func() bool {
+		return !configStore.Get().StreamOnDemand
+	})
+	if err != nil {
+		logger.Log().Sugar().Errorf("failed to create pre-transcoder: %v", err)
+		return
+	}
+	pretranscoder.Start()
+	defer pretranscoder.Close()
+
+	pregenerator := thumbnail.NewPregenerator(&dbObj, thumbnails, thumbnail.DefaultWorkers)
+	pregenerator.Start()
+	pregenerator.Trigger()
+	defer pregenerator.Close()
+
+	// Config changes, made through the API or to the file, are applied to
+	// the library in the background.
+	syncer := library.NewSyncer(config, &dbObj, pregenerator)
+	syncer.Start()
+	defer syncer.Close()
+	configStore.Subscribe(syncer.ConfigChanged)
+
+	configWatcher, err := watcher.NewConfigWatcher(configStore, watcher.DefaultDebounce, wsHub.ConfigRejected)
+	if err != nil {
+		logger.Log().Sugar().Errorf("failed to create config watcher: %v", err)
+		return
+	}
+	if err := configWatcher.Start(); err != nil {
+		logger.Log().Sugar().Errorf("failed to watch config: %v", err)
+		return
+	}
+	defer configWatcher.Close()
+
+	shares, err := share.NewManager(&dbObj)
+	if err != nil {
+		logger.Log().Sugar().Errorf("failed to load share links: %v", err)
+		return
+	}
+	shares.Start()
+	defer shares.Close()
+
+	handle := handlers.Handler{
+		DB:           &dbObj,
+		Logger:       logger.Log(),
+		Transcoder:   transcoder,
+		Thumbnails:   thumbnails,
+		Pregenerator: pregenerator,
+		Shares:       shares,
+		Hub:          wsHub,
+		Config:       configStore,
+	}
 
 	go func() {
 		defer wg.Done()
 
 		router.Use(cors.Handler(cors.Options{
 			// AllowedOrigins:   []string{"https://foo.com"}, // Use this to allow specific origin hosts
-			AllowedOrigins: []string{"http://localhost:5173", "http://127.0.0.1:5173", "http://localhost:4173", "http://127.0.0.1:4173", allowedOrigin, allowedOrigin2, "http://127.0.0.1:8000", "http://localhost:8000", "http://localhost:8080"},
+			AllowedOrigins: settings.CORSOrigins,
 			Debug:          true,
 			// AllowOriginFunc:  func(r *http.Request, origin string) bool { return true },
 			AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
@@ -113,15 +228,76 @@ func main() {
 			AllowCredentials: false,
 			MaxAge:           86400, // Maximum value not ignored by any of major browsers
 		}))
-		router.Get("/media/all", handle.GetAll)
-		router.Get("/media/{id}/stream", handle.StreamMedia)
-		router.Get("/media/paginated", handle.GetPaginatedHandler)
-		router.Get("/media/{id}", handle.GetByID)
-		router.Get("/media/{id}/thumbnail", handle.ThumbnailHandler)
+		router.Post("/auth/login", handle.Login)
+		router.With(handle.RequireAuthOrShare(database.ScopeStream, true)).Get("/media/{id}/stream", handle.StreamMedia)
+		router.With(handle.RequireAuthOrShare(database.ScopeRead, false)).Get("/media/{id}/thumbnail", handle.ThumbnailHandler)
+		router.Group(func(r chi.Router) {
+			r.Use(handle.RequireAuth)
+			r.With(handle.RequireScope(database.ScopeRead)).Get("/auth/me", handle.Me)
+
+			// Account management works with sessions only, not API keys.
+			r.Group(func(r chi.Router) {
+				r.Use(handle.RequireSession)
+				r.Post("/auth/logout", handle.Logout)
+				r.Group(func(r chi.Router) {
+					r.Use(handle.RequireRole(database.RoleAdmin, database.RoleUser))
+					r.Put("/auth/password", handle.ChangePassword)
+					r.Get("/auth/keys", handle.ListAPIKeys)
+					r.Post("/auth/keys", handle.CreateAPIKey)
+					r.Delete("/auth/keys/{id}", handle.DeleteAPIKey)
+				})
+			})
+
+			r.Route("/users", func(r chi.Router) {
+				r.Use(handle.RequireScope(database.ScopeAdmin), handle.RequireRole(database.RoleAdmin))
+				r.Get("/", handle.ListUsers)
+				r.Post("/", handle.CreateUser)
+				r.Put("/{id}", handle.UpdateUser)
+				r.Delete("/{id}", handle.DeleteUser)
+			})
+
+			r.Route("/config", func(r chi.Router) {
+				r.Use(handle.RequireScope(database.ScopeAdmin), handle.RequireRole(database.RoleAdmin))
+				r.Get("/", handle.GetConfig)
+				r.Post("/folders", handle.AddFolder)
+				r.Delete("/folders", handle.RemoveFolder)
+				r.Post("/toggle_stream", handle.ToggleStream)
+				r.Get("/browse", handle.Browse)
+			})
+
+			r.Group(func(r chi.Router) {
+				r.Use(handle.RequireScope(database.ScopeRead))
+				r.Get("/media/all", handle.GetAll)
+				r.Get("/media/paginated", handle.GetPaginatedHandler)
+				r.Get("/media/search", handle.SearchHandler)
+				r.Get("/media/continue", handle.ContinueWatching)
+				r.Get("/media/{id}", handle.GetByID)
+				r.Get("/media/{id}/progress", handle.GetProgress)
+				r.Get("/shares", handle.ListShares)
+				r.Get("/thumbnails/progress", handle.ThumbnailProgress)
+			})
+
+			r.Group(func(r chi.Router) {
+				r.Use(handle.RequireScope(database.ScopeStream))
+				r.Get("/media/{id}/hls/master.m3u8", handle.HLSMasterPlaylist)
+				r.Get("/media/{id}/hls/index.m3u8", handle.HLSMediaPlaylist)
+				r.Get("/media/{id}/hls/{index:[0-9]+}.ts", handle.HLSSegment)
+				r.Group(func(r chi.Router) {
+					r.Use(handle.RequireRole(database.RoleAdmin, database.RoleUser))
+					r.Put("/media/{id}/progress", handle.ReportProgress)
+					r.Post("/media/{id}/share", handle.CreateShare)
+					r.Delete("/shares/{id}", handle.RevokeShare)
+				})
+			})
+		})
+		if u, err := url.Parse(settings.SwaggerURL); err == nil && u.Host != "" {
+			docs.SwaggerInfo.Host = u.Host
+		}
 		router.Get("/docs/*", httpSwagger.Handler(
-			httpSwagger.URL("http://localhost:8000/docs/doc.json"), // CORRECT
+			httpSwagger.URL(settings.SwaggerURL),
 		))
 
+		logger.Log().Sugar().Infof("HTTP server running on %s", srv.Addr)
 		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 			logger.Log().Sugar().Errorf("server failed to start %v\n", err)
 			return
@@ -129,7 +305,7 @@ func main() {
 	}()
 	wsRouter := chi.NewRouter()
 	wssrv := &http.Server{
-		Addr:         ":9000",
+		Addr:         settings.WSAddr(),
 		Handler:      wsRouter,
 		ReadTimeout:  10 * time.Second,
 		WriteTimeout: 10 * time.Second,
@@ -138,7 +314,7 @@ func main() {
 	go func() {
 		defer wg.Done()
 
-		wsRouter.Get("/ws", func(w http.ResponseWriter, r *http.Request) {
+		wsRouter.With(handle.RequireAuth).Get("/ws", func(w http.ResponseWriter, r *http.Request) {
 			logger.Log().Info("new connection recived")
 			conn, err := upgrader.Upgrade(w, r, nil)
 			if err != nil {
@@ -146,10 +322,10 @@ func main() {
 				return
 			}
 			defer conn.Close()
-			handle.MediaConfigWS(conn)
+			handle.MediaConfigWS(conn, handlers.CurrentUser(r))
 		})
 
-		logger.Log().Info("WebSocket server running on :9000")
+		logger.Log().Sugar().Infof("WebSocket server running on %s", wssrv.Addr)
 		if err := wssrv.ListenAndServe(); err != nil {
 			logger.Log().Sugar().Fatalf("WebSocket server failed: %v", err)
 		}
@@ -209,3 +385,20 @@ func ShutdownServers(servers []*http.Server) error {
 	logger.Log().Info("All servers shutdown complete")
 	return nil
 }
+
+// writePrivateFile writes data to path, readable by the owner only. An
+// existing file is replaced.
+func writePrivateFile(path string, data string) error {
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := file.WriteString(data); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}